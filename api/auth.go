@@ -1,19 +1,15 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
-	"html/template"
 	"net/http"
-	"time"
 
 	"github.com/apex/log"
-	"github.com/aws/aws-sdk-go-v2/aws/awserr"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/gobuffalo/packr"
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 	uuid "github.com/satori/go.uuid"
-	"github.com/tj/go/env"
 	"github.com/tj/go/http/response"
 
 	"github.com/nerdify/tuc"
@@ -25,16 +21,36 @@ var views = packr.NewBox("./views")
 type AuthHandler struct {
 	UserService         tuc.UserService
 	LoginRequestService tuc.LoginRequestService
+	RefreshTokenService tuc.RefreshTokenService
+
+	// CardInviteService and CardService make users members of the cards
+	// shared with their email before they logged in.
+	CardInviteService tuc.CardInviteService
+	CardService       tuc.CardService
+
+	// Providers are the identity providers users log in with, by name.
+	Providers map[string]tuc.IdentityProvider
+
+	auth *Authenticator
 }
 
-// NewAuthHandler returns a new instance of AuthHandler.
-func NewAuthHandler(r *mux.Router) *AuthHandler {
-	h := &AuthHandler{}
+// NewAuthHandler returns a new instance of AuthHandler, issuing tokens and
+// authenticating requests with a.
+func NewAuthHandler(r *mux.Router, a *Authenticator) *AuthHandler {
+	h := &AuthHandler{
+		auth: a,
+	}
 
 	r.HandleFunc("/login", h.handleLogin).Methods(http.MethodPost)
-	r.HandleFunc("/login/facebook", h.handleFacebookLogin).Methods(http.MethodPost)
+	r.HandleFunc("/login/{provider}", h.handleProviderLogin).Methods(http.MethodPost)
 	r.HandleFunc("/authenticate", h.handleAuthenticate).Methods(http.MethodGet)
 	r.HandleFunc("/access_token", h.handleAccessToken).Methods(http.MethodPost)
+	r.HandleFunc("/token/refresh", h.handleRefreshToken).Methods(http.MethodPost)
+
+	s := r.PathPrefix("/logout").Subrouter()
+	s.Use(a.Authenticate)
+	s.HandleFunc("", h.handleLogout).Methods(http.MethodPost)
+	s.HandleFunc("/all", h.handleLogoutAll).Methods(http.MethodPost)
 
 	return h
 }
@@ -56,7 +72,7 @@ func (h *AuthHandler) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	u, err := h.UserService.Find(body.Email)
+	u, err := findOrCreateUser(r.Context(), h.UserService, body.Email, nil)
 
 	if err != nil {
 		log.WithError(err).Error("loading user")
@@ -64,26 +80,15 @@ func (h *AuthHandler) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if u == nil {
-		u = &tuc.User{
-			ID: body.Email,
-		}
-
-		if err := h.UserService.Create(u); err != nil {
-			log.WithError(err).Error("creating user")
-			response.InternalServerError(w)
-			return
-		}
-	}
-
 	v := tuc.LoginRequest{
+		Email:             u.Email,
 		RequestToken:      uuid.NewV4().String(),
 		UserID:            u.ID,
 		VerificationToken: uuid.NewV4().String(),
 		Verified:          false,
 	}
 
-	if err = h.LoginRequestService.Create(&v); err != nil {
+	if err = h.LoginRequestService.Create(r.Context(), &v); err != nil {
 		log.WithError(err).Error("creating login request")
 		response.InternalServerError(w)
 		return
@@ -94,87 +99,111 @@ func (h *AuthHandler) handleLogin(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (h *AuthHandler) handleFacebookLogin(w http.ResponseWriter, r *http.Request) {
+// handleProviderLogin logs in with a token of an identity provider.
+func (h *AuthHandler) handleProviderLogin(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["provider"]
+
+	l := log.WithField("provider", name)
+
+	p, ok := h.Providers[name]
+
+	if !ok {
+		l.Warn("unknown provider")
+		response.NotFound(w)
+		return
+	}
+
+	// access_token and id_token are what facebook and google call them
 	var body struct {
 		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+		Token       string `json:"token"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		log.WithError(err).Error("parsing body")
+		l.WithError(err).Error("parsing body")
 		response.BadRequest(w)
 		return
 	}
 
-	res, err := http.Get("https://graph.facebook.com/me?fields=email,id&access_token=" + body.AccessToken)
-	if err != nil {
-		log.WithError(err).Error("requesting facebook permissions")
-		response.InternalServerError(w)
-		return
+	credential := body.Token
+
+	if credential == "" {
+		credential = body.AccessToken
 	}
-	defer res.Body.Close()
 
-	if res.StatusCode != 200 {
-		log.Error("invalid access token")
-		response.BadRequest(w)
+	if credential == "" {
+		credential = body.IDToken
+	}
+
+	identity, err := p.Verify(r.Context(), credential)
+
+	if errors.Cause(err) == tuc.ErrInvalidIdentityToken {
+		l.WithError(err).Warn("invalid token")
+		response.Unauthorized(w)
 		return
 	}
 
-	var fbr struct {
-		Email string `json:"email"`
-		ID    string `json:"id"`
+	if err != nil {
+		l.WithError(err).Error("verifying token")
+		response.InternalServerError(w)
+		return
 	}
 
-	if err := json.NewDecoder(res.Body).Decode(&fbr); err != nil {
-		log.WithError(err).Error("parsing facebook response")
+	l = l.WithField("email", identity.Email)
+
+	// the subject outlives the email, which the user can change
+	u, err := h.UserService.FindByIdentity(r.Context(), name, identity.Subject)
+
+	if err != nil {
+		l.WithError(err).Error("loading user")
 		response.InternalServerError(w)
 		return
 	}
 
-	if fbr.Email == "" {
-		response.Unauthorized(w)
+	if u != nil {
+		h.respondTokens(w, r, l, u)
 		return
 	}
 
-	u, err := h.UserService.Find(fbr.Email)
+	u, err = findOrCreateUser(r.Context(), h.UserService, identity.Email, map[string]string{
+		name: identity.Subject,
+	})
+
 	if err != nil {
-		log.WithError(err).Error("loading user")
+		l.WithError(err).Error("loading user")
 		response.InternalServerError(w)
 		return
 	}
 
-	if u == nil {
-		u = &tuc.User{
-			FacebookID: fbr.ID,
-			ID:         fbr.Email,
-		}
-
-		if err := h.UserService.Create(u); err != nil {
-			log.WithError(err).Error("creating user")
-			response.InternalServerError(w)
-			return
-		}
-	} else if u.FacebookID == "" {
-		u.FacebookID = fbr.ID
-
-		if err := h.UserService.Update(u); err != nil {
-			log.WithError(err).Error("updating item")
+	// also claims subjects linked before they were claimed
+	if linked := u.Identities[name]; linked == "" || linked == identity.Subject {
+		if err := h.UserService.Link(r.Context(), u.ID, name, identity.Subject); err != nil {
+			l.WithError(err).Error("linking identity")
 			response.InternalServerError(w)
 			return
 		}
 	}
 
-	token, err := generateAccessToken(fbr.Email)
+	h.respondTokens(w, r, l, u)
+}
+
+// respondTokens responds with the email of a user and new tokens.
+func (h *AuthHandler) respondTokens(w http.ResponseWriter, r *http.Request, l log.Interface, u *tuc.User) {
+	h.acceptInvites(r.Context(), u)
+
+	t, err := h.issueTokens(r.Context(), u.ID)
 
 	if err != nil {
-		log.WithError(err).Error("signed token")
+		l.WithError(err).Error("issuing tokens")
 		response.InternalServerError(w)
 		return
 	}
 
-	response.OK(w, map[string]string{
-		"email": u.ID,
-		"token": token,
-	})
+	response.OK(w, struct {
+		Email string `json:"email"`
+		*tokens
+	}{u.Email, t})
 }
 
 func (h *AuthHandler) handleAuthenticate(w http.ResponseWriter, r *http.Request) {
@@ -186,14 +215,25 @@ func (h *AuthHandler) handleAuthenticate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := h.LoginRequestService.Verify(email, token); err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			case dynamodb.ErrCodeConditionalCheckFailedException:
-				log.WithError(aerr).Error("condition failed")
-				response.Unauthorized(w)
-				return
-			}
+	u, err := h.UserService.FindByEmail(r.Context(), email)
+
+	if err != nil {
+		log.WithError(err).Error("loading user")
+		response.InternalServerError(w)
+		return
+	}
+
+	if u == nil {
+		log.WithField("email", email).Warn("user does not exist")
+		response.Unauthorized(w)
+		return
+	}
+
+	if err := h.LoginRequestService.Verify(r.Context(), u.ID, token); err != nil {
+		if err == tuc.ErrInvalidLoginRequest {
+			log.WithError(err).Error("condition failed")
+			response.Unauthorized(w)
+			return
 		}
 
 		log.WithError(err).Error("authenticating")
@@ -201,9 +241,7 @@ func (h *AuthHandler) handleAuthenticate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	t := template.Must(template.New("").Parse(views.String("authenticate.html")))
-
-	t.Execute(w, map[string]string{})
+	renderMessage(w, "Dirección de correo electrónico confirmada", "¡Ahora puedes cerrar esta ventana y regresar a la aplicación!")
 }
 
 func (h *AuthHandler) handleAccessToken(w http.ResponseWriter, r *http.Request) {
@@ -218,14 +256,25 @@ func (h *AuthHandler) handleAccessToken(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := h.LoginRequestService.Delete(body.Email, body.Code); err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			case dynamodb.ErrCodeConditionalCheckFailedException:
-				log.WithError(aerr).Error("condition failed")
-				response.Unauthorized(w)
-				return
-			}
+	u, err := h.UserService.FindByEmail(r.Context(), body.Email)
+
+	if err != nil {
+		log.WithError(err).Error("loading user")
+		response.InternalServerError(w)
+		return
+	}
+
+	if u == nil {
+		log.WithField("email", body.Email).Warn("user does not exist")
+		response.Unauthorized(w)
+		return
+	}
+
+	if err := h.LoginRequestService.Delete(r.Context(), u.ID, body.Code); err != nil {
+		if err == tuc.ErrInvalidLoginRequest {
+			log.WithError(err).Error("condition failed")
+			response.Unauthorized(w)
+			return
 		}
 
 		log.WithError(err).Error("deleting request")
@@ -233,26 +282,60 @@ func (h *AuthHandler) handleAccessToken(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	token, err := generateAccessToken(body.Email)
+	h.acceptInvites(r.Context(), u)
+
+	t, err := h.issueTokens(r.Context(), u.ID)
 
 	if err != nil {
-		log.WithError(err).Error("signed token")
+		log.WithError(err).Error("issuing tokens")
 		response.InternalServerError(w)
 		return
 	}
 
-	response.OK(w, map[string]string{
-		"token": token,
-	})
+	response.OK(w, t)
 }
 
-func generateAccessToken(email string) (string, error) {
-	key := []byte(env.Get("JWT_KEY"))
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
-		Id:       email,
-		IssuedAt: time.Now().Unix(),
-		Issuer:   "saldotuc.com",
-	})
+// acceptInvites makes a user a member of the cards shared with their email
+// before they logged in.
+//
+// Failures are only logged, leaving the invites for the next login.
+func (h *AuthHandler) acceptInvites(ctx context.Context, u *tuc.User) {
+	l := log.WithField("user", u.ID)
+
+	invites, err := h.CardInviteService.ListByEmail(ctx, u.Email)
+
+	if err != nil {
+		l.WithError(err).Error("loading invites")
+		return
+	}
+
+	for _, i := range invites {
+		if err := h.acceptInvite(ctx, u, &i); err != nil {
+			l.WithField("card", i.CardID).WithError(err).Error("accepting invite")
+		}
+	}
+}
+
+func (h *AuthHandler) acceptInvite(ctx context.Context, u *tuc.User, i *tuc.CardInvite) error {
+	card, err := h.CardService.Get(ctx, i.OwnerID, i.CardID)
+
+	if err != nil {
+		return errors.Wrap(err, "loading card")
+	}
+
+	// the card may be gone since it was shared
+	if card != nil && card.UserID != u.ID {
+		err := h.CardService.Share(ctx, &tuc.CardMember{
+			CardID:     i.CardID,
+			OwnerID:    i.OwnerID,
+			Permission: i.Permission,
+			UserID:     u.ID,
+		})
+
+		if err != nil {
+			return errors.Wrap(err, "sharing card")
+		}
+	}
 
-	return token.SignedString(key)
+	return errors.Wrap(h.CardInviteService.Delete(ctx, i.CardID, i.Email), "deleting invite")
 }
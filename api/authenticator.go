@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/apex/log"
+	jwtmiddleware "github.com/auth0/go-jwt-middleware"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"github.com/tj/go/http/response"
+
+	"github.com/nerdify/tuc"
+	"github.com/nerdify/tuc/keyset"
+)
+
+// Authenticator signs access tokens and authenticates requests with them.
+type Authenticator struct {
+	keyset      *keyset.Keyset
+	middleware  *jwtmiddleware.JWTMiddleware
+	revocations tuc.RevocationService
+}
+
+// NewAuthenticator returns a new instance of Authenticator signing and
+// verifying tokens with ks. Revocations are checked against s, and no token
+// is revoked while it is nil.
+func NewAuthenticator(ks *keyset.Keyset, s tuc.RevocationService) *Authenticator {
+	a := &Authenticator{
+		keyset:      ks,
+		revocations: s,
+	}
+
+	a.middleware = jwtmiddleware.New(jwtmiddleware.Options{
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err string) {
+			log.Error(err)
+			response.Unauthorized(w)
+		},
+		UserProperty:        "token",
+		ValidationKeyGetter: a.verificationKey,
+	})
+
+	return a
+}
+
+// Authenticate rejects requests without a valid access token or with a
+// revoked one.
+func (a *Authenticator) Authenticate(next http.Handler) http.Handler {
+	return a.middleware.Handler(a.checkRevoked(next))
+}
+
+// HandleJWKS publishes the public keys access tokens are verified with.
+func (a *Authenticator) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	response.OK(w, a.keyset.JWKS())
+}
+
+func (a *Authenticator) verificationKey(token *jwt.Token) (interface{}, error) {
+	claims := token.Claims.(jwt.MapClaims)
+
+	// tokens issued before they expired would be valid forever
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("token has no expiry")
+	}
+
+	// tokens issued before users had ids carry the email instead
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	return a.keyset.VerificationKey(token)
+}
@@ -1,62 +1,74 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"math"
 	"net/http"
 	"regexp"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/apex/log"
-	jwtmiddleware "github.com/auth0/go-jwt-middleware"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
 	gocache "github.com/patrickmn/go-cache"
 	"github.com/pkg/errors"
 	uuid "github.com/satori/go.uuid"
-	"github.com/tj/go/env"
 	"github.com/tj/go/http/response"
 
 	"github.com/nerdify/tuc"
 	"github.com/nerdify/tuc/client"
+	"github.com/nerdify/tuc/events"
+	"github.com/nerdify/tuc/fare"
 )
 
-var c = client.NewClient(env.Get("ENDPOINT"))
 var cache = gocache.New(5*time.Minute, 10*time.Minute)
-var jwtMiddleware = jwtmiddleware.New(jwtmiddleware.Options{
-	ErrorHandler: func(w http.ResponseWriter, r *http.Request, err string) {
-		log.Error(err)
-		response.Unauthorized(w)
-	},
-	SigningMethod: jwt.SigningMethodHS256,
-	UserProperty:  "token",
-	ValidationKeyGetter: func(token *jwt.Token) (interface{}, error) {
-		return []byte(env.Get("JWT_KEY")), nil
-	},
-})
+
+// Page sizes of paginated listings.
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
 
 // CardHandler handles communication with the Card related methods.
 type CardHandler struct {
-	CardService tuc.CardService
+	BalanceHistoryService tuc.BalanceHistoryService
+	CardEventService      tuc.CardEventService
+	CardInviteService     tuc.CardInviteService
+	CardService           tuc.CardService
+	Client                *client.Client
+	Fares                 *fare.Table
+	Recorder              *events.Recorder
+	UserService           tuc.UserService
 }
 
-// NewCardHandler returns a new instance of CardHandler.
-func NewCardHandler(r *mux.Router) *CardHandler {
+// NewCardHandler returns a new instance of CardHandler, authenticating
+// requests with a.
+func NewCardHandler(r *mux.Router, a *Authenticator) *CardHandler {
 	h := &CardHandler{}
 
-	s := r.NewRoute().Subrouter()
-	s.Use(jwtMiddleware.Handler)
-	s.HandleFunc("/cards", h.handleGetCards).Methods(http.MethodGet)
-	s.HandleFunc("/cards", h.handlePostCard).Methods(http.MethodPost)
-	s.HandleFunc("/cards/{card}", h.handleDeleteCard).Methods(http.MethodDelete)
-	s.HandleFunc("/cards/{card}/balance", h.handleGetCardBalance).Methods(http.MethodGet)
+	// a path prefix keeps gorilla/mux from leaking a failed match of this
+	// subrouter into the middleware of the next ones
+	s := r.PathPrefix("/cards").Subrouter()
+	s.Use(a.Authenticate)
+	s.HandleFunc("", h.handleGetCards).Methods(http.MethodGet)
+	s.HandleFunc("", h.handlePostCard).Methods(http.MethodPost)
+	s.HandleFunc("/{card}", h.handlePatchCard).Methods(http.MethodPatch)
+	s.HandleFunc("/{card}", h.handleDeleteCard).Methods(http.MethodDelete)
+	s.HandleFunc("/{card}/balance", h.handleGetCardBalance).Methods(http.MethodGet)
+	s.HandleFunc("/{card}/events", h.handleGetCardEvents).Methods(http.MethodGet)
+	s.HandleFunc("/{card}/history", h.handleGetCardHistory).Methods(http.MethodGet)
+	s.HandleFunc("/{card}/members", h.handleGetCardMembers).Methods(http.MethodGet)
+	s.HandleFunc("/{card}/members", h.handlePostCardMember).Methods(http.MethodPost)
+	s.HandleFunc("/{card}/members/{email}", h.handleDeleteCardMember).Methods(http.MethodDelete)
 
 	return h
 }
 
 func (h *CardHandler) handleGetCards(w http.ResponseWriter, r *http.Request) {
 	userID := getUserID(r)
-	cards, err := h.CardService.List(userID)
+	cards, err := h.CardService.List(r.Context(), userID)
 
 	if err != nil {
 		log.WithError(err).Error("loading cards")
@@ -64,7 +76,18 @@ func (h *CardHandler) handleGetCards(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response.OK(w, cards)
+	f := h.Fares.Fare("", time.Now())
+	res := make([]cardResponse, len(cards))
+
+	for i, card := range cards {
+		res[i] = cardResponse{
+			Card:           card,
+			Fare:           f,
+			TripsRemaining: fare.TripsRemaining(card.Balance, f),
+		}
+	}
+
+	response.OK(w, res)
 }
 
 func (h *CardHandler) handlePostCard(w http.ResponseWriter, r *http.Request) {
@@ -90,53 +113,154 @@ func (h *CardHandler) handlePostCard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	out, err := c.GetBalance(&client.RequestInput{
-		Card: body.Number,
-	})
-
-	if err != nil {
-		log.WithError(err).Error("making request")
-		response.InternalServerError(w)
-		return
-	}
+	userID := getUserID(r)
 
-	if out.Code == 2 {
-		l.Warn("card does not exist")
-		response.NotFound(w)
+	// avoid asking the upstream for cards already registered
+	if h.cardExists(w, r, l, userID, body.Number) {
 		return
 	}
 
-	data := out.Data[0]
+	b, err := h.Client.Balance(r.Context(), body.Number)
 
-	if strings.ToLower(data.Status) == "bloqueado" {
-		l.Warn("inactive card")
-		response.BadRequest(w)
+	if err != nil {
+		h.balanceError(w, l, err)
 		return
 	}
 
 	card := &tuc.Card{
-		Balance: data.Balance,
-		ID:      uuid.NewV4().String(),
+		Balance: b.Balance,
+		ID:      newCardID(userID, body.Number),
 		Name:    body.Name,
 		Number:  body.Number,
-		UserID:  getUserID(r),
+		UserID:  userID,
+	}
+
+	err = h.CardService.Create(r.Context(), card)
+
+	if err == tuc.ErrCardExists && h.cardExists(w, r, l, userID, body.Number) {
+		return
 	}
 
-	if err := h.CardService.Create(card); err != nil {
+	if err != nil {
 		l.WithError(err).Error("creating card")
 		response.InternalServerError(w)
 		return
 	}
 
+	h.Recorder.Append(r.Context(), card.ID, card.Balance)
+
 	response.Created(w, card)
 }
 
+// cardExists responds with 409 and the existing card when the user already
+// registered the number, reporting whether it did respond.
+func (h *CardHandler) cardExists(w http.ResponseWriter, r *http.Request, l log.Interface, userID, number string) bool {
+	cards, err := h.CardService.List(r.Context(), userID)
+
+	if err != nil {
+		l.WithError(err).Error("getting cards")
+		response.InternalServerError(w)
+		return true
+	}
+
+	for _, c := range cards {
+		if c.Number == number && c.Permission == tuc.CardPermissionOwner {
+			l.WithField("card", c.ID).Warn("card already exists")
+			response.Conflict(w, c)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *CardHandler) handlePatchCard(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	cardID := vars["card"]
+	userID := getUserID(r)
+
+	l := log.WithField("card", cardID)
+
+	var body tuc.CardPatch
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		l.WithError(err).Error("parsing body")
+		response.BadRequest(w)
+		return
+	}
+
+	if err := validateCardPatch(&body); err != nil {
+		l.Error("invalid request")
+		response.JSON(w, map[string]string{"message": err.Error()}, http.StatusUnprocessableEntity)
+		return
+	}
+
+	card, err := h.CardService.Get(r.Context(), userID, cardID)
+
+	if err != nil {
+		l.WithError(err).Error("getting card")
+		response.InternalServerError(w)
+		return
+	}
+
+	if card == nil {
+		l.Warn("card does not exist")
+		response.NotFound(w)
+		return
+	}
+
+	if !card.Permission.CanManage() {
+		l.Warn("card is read-only")
+		response.Forbidden(w)
+		return
+	}
+
+	patched, err := h.CardService.Patch(r.Context(), card.UserID, cardID, &body)
+
+	if err != nil {
+		l.WithError(err).Error("updating card")
+		response.InternalServerError(w)
+		return
+	}
+
+	if patched == nil {
+		l.Warn("card does not exist")
+		response.NotFound(w)
+		return
+	}
+
+	patched.Permission = card.Permission
+
+	response.OK(w, patched)
+}
+
+// handleDeleteCard deletes a card of the user, or stops sharing it with them
+// when it is not theirs.
 func (h *CardHandler) handleDeleteCard(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
+	cardID := vars["card"]
 	userID := getUserID(r)
 
-	if err := h.CardService.Delete(userID, vars["card"]); err != nil {
-		log.WithError(err).Error("deleting card")
+	l := log.WithField("card", cardID)
+
+	card, err := h.CardService.Get(r.Context(), userID, cardID)
+
+	if err != nil {
+		l.WithError(err).Error("getting card")
+		response.InternalServerError(w)
+		return
+	}
+
+	switch {
+	case card == nil:
+	case card.Permission == tuc.CardPermissionOwner:
+		err = h.deleteCard(r.Context(), userID, cardID)
+	default:
+		err = h.CardService.Unshare(r.Context(), cardID, userID)
+	}
+
+	if err != nil {
+		l.WithError(err).Error("deleting card")
 		response.InternalServerError(w)
 		return
 	}
@@ -144,6 +268,33 @@ func (h *CardHandler) handleDeleteCard(w http.ResponseWriter, r *http.Request) {
 	response.NoContent(w)
 }
 
+// deleteCard deletes a card of the user along with its invites, history and
+// events, which would otherwise come back when the number is registered again
+// under the same id.
+func (h *CardHandler) deleteCard(ctx context.Context, userID, cardID string) error {
+	invites, err := h.CardInviteService.List(ctx, cardID)
+
+	if err != nil {
+		return errors.Wrap(err, "listing invites")
+	}
+
+	for _, i := range invites {
+		if err := h.CardInviteService.Delete(ctx, cardID, i.Email); err != nil {
+			return errors.Wrap(err, "deleting invite")
+		}
+	}
+
+	if err := h.BalanceHistoryService.Delete(ctx, cardID); err != nil {
+		return errors.Wrap(err, "deleting history")
+	}
+
+	if err := h.CardEventService.Delete(ctx, cardID); err != nil {
+		return errors.Wrap(err, "deleting events")
+	}
+
+	return h.CardService.Delete(ctx, userID, cardID)
+}
+
 func (h *CardHandler) handleGetCardBalance(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	cardID := vars["card"]
@@ -151,7 +302,7 @@ func (h *CardHandler) handleGetCardBalance(w http.ResponseWriter, r *http.Reques
 
 	l := log.WithField("card", cardID)
 
-	card, err := h.CardService.Get(userID, cardID)
+	card, err := h.CardService.Get(r.Context(), userID, cardID)
 
 	if err != nil {
 		l.WithError(err).Error("loading card")
@@ -167,66 +318,284 @@ func (h *CardHandler) handleGetCardBalance(w http.ResponseWriter, r *http.Reques
 
 	cacheKey := "tuc:" + card.Number
 
+	route := r.URL.Query().Get("route")
+
 	// get from cache
 	if balance, found := cache.Get(cacheKey); found {
-		response.OK(w, map[string]interface{}{
-			"balance": balance,
-		})
+		response.OK(w, h.balanceResponse(balance.(float64), route))
 		return
 	}
 
-	out, err := c.GetBalance(&client.RequestInput{
-		Card: card.Number,
-	})
+	b, err := h.Client.Balance(r.Context(), card.Number)
 
 	if err != nil {
-		l.WithError(err).Error("making request")
+		h.balanceError(w, l, err)
+		return
+	}
+
+	balance := b.Balance
+
+	card, err = h.Recorder.Record(r.Context(), card, balance)
+
+	if err != nil {
+		l.WithError(err).Error("updating card")
 		response.InternalServerError(w)
 		return
 	}
 
-	if out.Code == 2 {
-		l.Warn("card does not exist")
+	if card == nil {
+		l.Warn("card was deleted")
 		response.NotFound(w)
 		return
 	}
 
-	data := out.Data[0]
+	// set to cache
+	cache.SetDefault(cacheKey, balance)
+
+	response.OK(w, h.balanceResponse(balance, route))
+}
+
+func (h *CardHandler) handleGetCardHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	cardID := vars["card"]
+
+	l := log.WithField("card", cardID)
+
+	p, ok := h.loadPage(w, r, l, cardID)
+
+	if !ok {
+		return
+	}
+
+	snapshots, cursor, err := h.BalanceHistoryService.List(r.Context(), cardID, p.From, p.To, p.Limit, p.Cursor)
 
-	if strings.ToLower(data.Status) == "bloqueado" {
-		l.Warn("inactive card")
+	if err == tuc.ErrInvalidCursor {
+		l.WithError(err).Error("parsing cursor")
 		response.BadRequest(w)
 		return
 	}
 
-	balance := data.Balance
-
-	if _, err := h.CardService.Update(userID, cardID, balance); err != nil {
-		l.WithError(err).Error("updating card")
+	if err != nil {
+		l.WithError(err).Error("loading history")
 		response.InternalServerError(w)
 		return
 	}
 
-	// set to cache
-	cache.SetDefault(cacheKey, balance)
+	response.OK(w, map[string]interface{}{
+		"cursor":    cursor,
+		"snapshots": snapshots,
+	})
+}
+
+func (h *CardHandler) handleGetCardEvents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	cardID := vars["card"]
+
+	l := log.WithField("card", cardID)
+
+	p, ok := h.loadPage(w, r, l, cardID)
+
+	if !ok {
+		return
+	}
+
+	cardEvents, cursor, err := h.CardEventService.List(r.Context(), cardID, p.From, p.To, p.Limit, p.Cursor)
+
+	if err == tuc.ErrInvalidCursor {
+		l.WithError(err).Error("parsing cursor")
+		response.BadRequest(w)
+		return
+	}
+
+	if err != nil {
+		l.WithError(err).Error("loading events")
+		response.InternalServerError(w)
+		return
+	}
 
 	response.OK(w, map[string]interface{}{
-		"balance": balance,
+		"cursor": cursor,
+		"events": cardEvents,
 	})
 }
 
+// cardResponse is a card with its remaining trips.
+type cardResponse struct {
+	tuc.Card
+	Fare           float64 `json:"fare"`
+	TripsRemaining int     `json:"trips_remaining"`
+}
+
+// balanceResponse returns the response for a balance, with the remaining
+// trips at the current fare of route.
+func (h *CardHandler) balanceResponse(balance float64, route string) map[string]interface{} {
+	f := h.Fares.Fare(route, time.Now())
+
+	return map[string]interface{}{
+		"balance":         balance,
+		"fare":            f,
+		"trips_remaining": fare.TripsRemaining(balance, f),
+	}
+}
+
+// page is the range and pagination of a card listing.
+type page struct {
+	Cursor string
+	From   time.Time
+	Limit  int
+	To     time.Time
+}
+
+// loadPage parses the page of a card listing and checks that the card belongs
+// to the user, responding and returning false otherwise.
+func (h *CardHandler) loadPage(w http.ResponseWriter, r *http.Request, l log.Interface, cardID string) (*page, bool) {
+	query := r.URL.Query()
+	p := &page{
+		Cursor: query.Get("cursor"),
+	}
+
+	var err error
+
+	if p.From, err = parseTime(query.Get("from")); err != nil {
+		l.WithError(err).Error("parsing from")
+		response.BadRequest(w)
+		return nil, false
+	}
+
+	if p.To, err = parseTime(query.Get("to")); err != nil {
+		l.WithError(err).Error("parsing to")
+		response.BadRequest(w)
+		return nil, false
+	}
+
+	if p.Limit, err = parseLimit(query.Get("limit")); err != nil {
+		l.WithError(err).Error("parsing limit")
+		response.BadRequest(w)
+		return nil, false
+	}
+
+	card, err := h.CardService.Get(r.Context(), getUserID(r), cardID)
+
+	if err != nil {
+		l.WithError(err).Error("loading card")
+		response.InternalServerError(w)
+		return nil, false
+	}
+
+	if card == nil {
+		l.Warn("card does not exist")
+		response.NotFound(w)
+		return nil, false
+	}
+
+	return p, true
+}
+
+// balanceError responds to a failed balance request.
+func (h *CardHandler) balanceError(w http.ResponseWriter, l log.Interface, err error) {
+	switch errors.Cause(err) {
+	case client.ErrCardNotFound:
+		l.Warn("card does not exist")
+		response.NotFound(w)
+	case client.ErrCardBlocked:
+		l.Warn("inactive card")
+		response.BadRequest(w)
+	case client.ErrUpstreamMalformed:
+		l.WithError(err).Error("malformed response")
+		response.BadGateway(w)
+	case client.ErrCircuitOpen:
+		l.WithError(err).Warn("upstream unavailable")
+		retryAfter := int(math.Ceil(h.Client.Breaker.RetryAfter().Seconds()))
+
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		response.ServiceUnavailable(w)
+	default:
+		l.WithError(err).Error("making request")
+		response.InternalServerError(w)
+	}
+}
+
 func getUserID(r *http.Request) string {
 	token := r.Context().Value("token").(*jwt.Token)
 
-	return token.Claims.(jwt.MapClaims)["jti"].(string)
+	return token.Claims.(jwt.MapClaims)["sub"].(string)
+}
+
+// parseTime parses an optional RFC 3339 time.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+// parseLimit parses an optional page size, defaulting to defaultLimit and
+// capped to maxLimit.
+func parseLimit(s string) (int, error) {
+	if s == "" {
+		return defaultLimit, nil
+	}
+
+	n, err := strconv.Atoi(s)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if n < 1 {
+		return 0, errors.New("limit must be positive")
+	}
+
+	if n > maxLimit {
+		n = maxLimit
+	}
+
+	return n, nil
+}
+
+// cardNamespace is the namespace of card ids.
+var cardNamespace = uuid.Must(uuid.FromString("2a4cfb0c-6d51-4f4e-9a55-7f0b3c1e8d21"))
+
+// newCardID returns the id of the user's card with the given number. It is
+// derived from both so that registering a number twice at once conflicts in
+// storage rather than creating two cards.
+func newCardID(userID, number string) string {
+	return uuid.NewV5(cardNamespace, userID+":"+number).String()
 }
 
 func validateCard(name, number string) error {
-	if name == "" {
-		return errors.New("El nombre es requerido")
+	if err := validateName(name); err != nil {
+		return err
 	} else if m, _ := regexp.MatchString("^\\d{8}$", number); !m {
 		return errors.New("El número debe ser de 8 dígitos")
 	}
 
 	return nil
 }
+
+func validateCardPatch(p *tuc.CardPatch) error {
+	if p.Name != nil {
+		if err := validateName(*p.Name); err != nil {
+			return err
+		}
+	}
+
+	if p.LowBalanceThreshold != nil && *p.LowBalanceThreshold < 0 {
+		return errors.New("La alerta de saldo no puede ser negativa")
+	}
+
+	return nil
+}
+
+func validateName(name string) error {
+	if name == "" {
+		return errors.New("El nombre es requerido")
+	}
+
+	return nil
+}
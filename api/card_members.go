@@ -0,0 +1,244 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/apex/log"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/tj/go/http/response"
+
+	"github.com/nerdify/tuc"
+)
+
+func (h *CardHandler) handleGetCardMembers(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	cardID := vars["card"]
+
+	l := log.WithField("card", cardID)
+
+	if _, ok := h.ownCard(w, r, l, cardID); !ok {
+		return
+	}
+
+	members, err := h.CardService.Members(r.Context(), cardID)
+
+	if err != nil {
+		l.WithError(err).Error("getting members")
+		response.InternalServerError(w)
+		return
+	}
+
+	for i, m := range members {
+		u, err := h.UserService.Find(r.Context(), m.UserID)
+
+		if err != nil {
+			l.WithError(err).Error("loading member")
+			response.InternalServerError(w)
+			return
+		}
+
+		if u != nil {
+			members[i].Email = u.Email
+		}
+	}
+
+	invites, err := h.CardInviteService.List(r.Context(), cardID)
+
+	if err != nil {
+		l.WithError(err).Error("getting invites")
+		response.InternalServerError(w)
+		return
+	}
+
+	for _, i := range invites {
+		members = append(members, tuc.CardMember{
+			Email:      i.Email,
+			Pending:    true,
+			Permission: i.Permission,
+		})
+	}
+
+	response.OK(w, members)
+}
+
+func (h *CardHandler) handlePostCardMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	cardID := vars["card"]
+
+	l := log.WithField("card", cardID)
+
+	var body struct {
+		Email      string             `json:"email"`
+		Permission tuc.CardPermission `json:"permission"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		l.WithError(err).Error("parsing body")
+		response.BadRequest(w)
+		return
+	}
+
+	if body.Permission == "" {
+		body.Permission = tuc.CardPermissionRead
+	}
+
+	l = l.WithFields(log.Fields{
+		"email":      body.Email,
+		"permission": body.Permission,
+	})
+
+	card, ok := h.ownCard(w, r, l, cardID)
+
+	if !ok {
+		return
+	}
+
+	if err := validateMember(body.Email, body.Permission); err != nil {
+		l.Error("invalid request")
+		response.JSON(w, map[string]string{"message": err.Error()}, http.StatusUnprocessableEntity)
+		return
+	}
+
+	u, err := h.UserService.FindByEmail(r.Context(), body.Email)
+
+	if err != nil {
+		l.WithError(err).Error("loading member")
+		response.InternalServerError(w)
+		return
+	}
+
+	// people yet to log in are invited, and become members once they do
+	if u == nil {
+		h.inviteMember(w, r, l, card, body.Email, body.Permission)
+		return
+	}
+
+	if u.ID == card.UserID {
+		l.Error("invalid request")
+		response.JSON(w, map[string]string{"message": "La tarjeta ya es tuya"}, http.StatusUnprocessableEntity)
+		return
+	}
+
+	member := &tuc.CardMember{
+		CardID:     cardID,
+		Email:      u.Email,
+		OwnerID:    card.UserID,
+		Permission: body.Permission,
+		UserID:     u.ID,
+	}
+
+	if err := h.CardService.Share(r.Context(), member); err != nil {
+		l.WithError(err).Error("sharing card")
+		response.InternalServerError(w)
+		return
+	}
+
+	response.Created(w, member)
+}
+
+// inviteMember shares a card with an email nobody logged in with yet.
+func (h *CardHandler) inviteMember(w http.ResponseWriter, r *http.Request, l log.Interface, card *tuc.Card, email string, permission tuc.CardPermission) {
+	invite := &tuc.CardInvite{
+		CardID:     card.ID,
+		Email:      email,
+		OwnerID:    card.UserID,
+		Permission: permission,
+	}
+
+	if err := h.CardInviteService.Create(r.Context(), invite); err != nil {
+		l.WithError(err).Error("inviting member")
+		response.InternalServerError(w)
+		return
+	}
+
+	response.Created(w, &tuc.CardMember{
+		Email:      invite.Email,
+		Pending:    true,
+		Permission: invite.Permission,
+	})
+}
+
+// handleDeleteCardMember stops sharing a card. Owners may remove any member
+// and members may remove themselves.
+func (h *CardHandler) handleDeleteCardMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	cardID := vars["card"]
+	email := vars["email"]
+	userID := getUserID(r)
+
+	l := log.WithFields(log.Fields{
+		"card":  cardID,
+		"email": email,
+	})
+
+	u, err := h.UserService.FindByEmail(r.Context(), email)
+
+	if err != nil {
+		l.WithError(err).Error("loading member")
+		response.InternalServerError(w)
+		return
+	}
+
+	if u == nil || u.ID != userID {
+		if _, ok := h.ownCard(w, r, l, cardID); !ok {
+			return
+		}
+	}
+
+	// nobody with the email means at most an invite to remove
+	if u == nil {
+		if err := h.CardInviteService.Delete(r.Context(), cardID, email); err != nil {
+			l.WithError(err).Error("deleting invite")
+			response.InternalServerError(w)
+			return
+		}
+
+		response.NoContent(w)
+		return
+	}
+
+	if err := h.CardService.Unshare(r.Context(), cardID, u.ID); err != nil {
+		l.WithError(err).Error("unsharing card")
+		response.InternalServerError(w)
+		return
+	}
+
+	response.NoContent(w)
+}
+
+// ownCard gets a card the user owns, responding with 404 or 403 otherwise.
+func (h *CardHandler) ownCard(w http.ResponseWriter, r *http.Request, l log.Interface, cardID string) (*tuc.Card, bool) {
+	card, err := h.CardService.Get(r.Context(), getUserID(r), cardID)
+
+	if err != nil {
+		l.WithError(err).Error("getting card")
+		response.InternalServerError(w)
+		return nil, false
+	}
+
+	if card == nil {
+		l.Warn("card does not exist")
+		response.NotFound(w)
+		return nil, false
+	}
+
+	if card.Permission != tuc.CardPermissionOwner {
+		l.Warn("card is not owned by the user")
+		response.Forbidden(w)
+		return nil, false
+	}
+
+	return card, true
+}
+
+func validateMember(email string, permission tuc.CardPermission) error {
+	if !validEmail(email) {
+		return errors.New("El correo electrónico no es válido")
+	} else if permission != tuc.CardPermissionRead && permission != tuc.CardPermissionManage {
+		return errors.New("El permiso debe ser read o manage")
+	}
+
+	return nil
+}
@@ -0,0 +1,549 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/discard"
+	"github.com/gorilla/mux"
+
+	"github.com/nerdify/tuc"
+	"github.com/nerdify/tuc/client"
+	"github.com/nerdify/tuc/client/fake"
+	"github.com/nerdify/tuc/events"
+	"github.com/nerdify/tuc/fare"
+	"github.com/nerdify/tuc/keyset"
+	"github.com/nerdify/tuc/memory"
+)
+
+func init() {
+	log.SetHandler(discard.Default)
+}
+
+// testServer is the api backed by memory services and a fake upstream.
+type testServer struct {
+	auth     *Authenticator
+	cards    *memory.CardService
+	invites  *memory.CardInviteService
+	client   *client.Client
+	router   *mux.Router
+	upstream *fake.Server
+	users    *memory.UserService
+
+	close func()
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	ks := &keyset.Keyset{
+		Keys: []*keyset.Key{
+			keyset.NewHMAC("", []byte("secret")),
+		},
+	}
+
+	upstream := fake.New()
+	us := httptest.NewServer(upstream)
+
+	s := &testServer{
+		auth:     NewAuthenticator(ks, &memory.RevocationService{}),
+		cards:    &memory.CardService{},
+		client:   client.NewClient(us.URL),
+		invites:  &memory.CardInviteService{},
+		router:   mux.NewRouter(),
+		upstream: upstream,
+		users:    &memory.UserService{},
+		close:    us.Close,
+	}
+
+	s.client.MaxRetries = 0
+
+	ah := NewAuthHandler(s.router, s.auth)
+	ah.CardInviteService = s.invites
+	ah.CardService = s.cards
+	ah.LoginRequestService = &memory.LoginRequestService{}
+	ah.Providers = map[string]tuc.IdentityProvider{
+		"test": testProvider{},
+	}
+	ah.RefreshTokenService = &memory.RefreshTokenService{}
+	ah.UserService = s.users
+
+	ch := NewCardHandler(s.router, s.auth)
+	ch.BalanceHistoryService = &memory.BalanceHistoryService{}
+	ch.CardEventService = &memory.CardEventService{}
+	ch.CardInviteService = s.invites
+	ch.CardService = s.cards
+	ch.Client = s.client
+	ch.Fares = fare.Default()
+	ch.Recorder = &events.Recorder{
+		BalanceHistoryService: ch.BalanceHistoryService,
+		CardEventService:      ch.CardEventService,
+		CardService:           s.cards,
+		Detector: &events.Detector{
+			Fares: ch.Fares,
+		},
+	}
+	ch.UserService = s.users
+
+	return s
+}
+
+// testProvider verifies tokens which are the email of the identity, and its
+// subject as well.
+type testProvider struct{}
+
+func (testProvider) Name() string {
+	return "test"
+}
+
+func (testProvider) Verify(ctx context.Context, token string) (*tuc.Identity, error) {
+	return &tuc.Identity{
+		Email:   token,
+		Subject: token,
+	}, nil
+}
+
+// user creates a user with an email.
+func (s *testServer) user(t *testing.T, id string) *tuc.User {
+	t.Helper()
+
+	u := &tuc.User{
+		Email: id + "@example.com",
+		ID:    id,
+	}
+
+	if err := s.users.Create(context.Background(), u); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	return u
+}
+
+// card creates a card of a user through the api.
+func (s *testServer) card(t *testing.T, userID, number string) *tuc.Card {
+	t.Helper()
+
+	s.upstream.SetCard(number, fake.Card{Balance: 10, Status: "Activo"})
+
+	var c tuc.Card
+
+	if res := s.do(t, http.MethodPost, "/cards", userID, map[string]string{"name": "Card", "number": number}, &c); res.Code != http.StatusCreated {
+		t.Fatalf("POST /cards = %d, want %d", res.Code, http.StatusCreated)
+	}
+
+	return &c
+}
+
+// do makes a request as a user, decoding the response into out when not nil.
+func (s *testServer) do(t *testing.T, method, path, userID string, body, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var b bytes.Buffer
+
+	if body != nil {
+		json.NewEncoder(&b).Encode(body)
+	}
+
+	r := httptest.NewRequest(method, path, &b)
+
+	if userID != "" {
+		token, err := s.auth.generateAccessToken(userID, "")
+		if err != nil {
+			t.Fatalf("signing token: %v", err)
+		}
+
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+
+	if out != nil && w.Code < 300 {
+		if err := json.NewDecoder(w.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+
+	return w
+}
+
+func TestPostCard(t *testing.T) {
+	t.Run("created", func(t *testing.T) {
+		s := newTestServer(t)
+		defer s.close()
+
+		c := s.card(t, "a", "10000001")
+
+		if c.Balance != 10 || c.Number != "10000001" || c.ID != newCardID("a", "10000001") {
+			t.Fatalf("POST /cards = %+v", c)
+		}
+	})
+
+	t.Run("duplicate", func(t *testing.T) {
+		s := newTestServer(t)
+		defer s.close()
+
+		c := s.card(t, "a", "10000002")
+
+		res := s.do(t, http.MethodPost, "/cards", "a", map[string]string{"name": "Other", "number": "10000002"}, nil)
+		if res.Code != http.StatusConflict {
+			t.Fatalf("POST /cards = %d, want %d", res.Code, http.StatusConflict)
+		}
+
+		var existing tuc.Card
+
+		if err := json.NewDecoder(res.Body).Decode(&existing); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+
+		if existing.ID != c.ID || existing.Name != "Card" {
+			t.Fatalf("POST /cards = %+v, want %+v", existing, c)
+		}
+	})
+
+	t.Run("same number for another user", func(t *testing.T) {
+		s := newTestServer(t)
+		defer s.close()
+
+		a := s.card(t, "a", "10000003")
+		b := s.card(t, "b", "10000003")
+
+		if a.ID == b.ID {
+			t.Fatalf("both users got card %s", a.ID)
+		}
+	})
+
+	t.Run("unknown card", func(t *testing.T) {
+		s := newTestServer(t)
+		defer s.close()
+
+		if res := s.do(t, http.MethodPost, "/cards", "a", map[string]string{"name": "Card", "number": "10000004"}, nil); res.Code != http.StatusNotFound {
+			t.Fatalf("POST /cards = %d, want %d", res.Code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("upstream unavailable", func(t *testing.T) {
+		s := newTestServer(t)
+		defer s.close()
+
+		s.client.Breaker = client.NewBreaker(1, 30*time.Second)
+		s.upstream.SetCard("10000005", fake.Card{Balance: 10, Status: "Activo"})
+		s.upstream.Script("10000005", fake.Step{Status: 500})
+
+		body := map[string]string{"name": "Card", "number": "10000005"}
+
+		if res := s.do(t, http.MethodPost, "/cards", "a", body, nil); res.Code != http.StatusInternalServerError {
+			t.Fatalf("POST /cards = %d, want %d", res.Code, http.StatusInternalServerError)
+		}
+
+		res := s.do(t, http.MethodPost, "/cards", "a", body, nil)
+		if res.Code != http.StatusServiceUnavailable {
+			t.Fatalf("POST /cards = %d, want %d", res.Code, http.StatusServiceUnavailable)
+		}
+
+		if got := res.Header().Get("Retry-After"); got != "30" {
+			t.Fatalf("Retry-After = %q, want %q", got, "30")
+		}
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		s := newTestServer(t)
+		defer s.close()
+
+		if res := s.do(t, http.MethodPost, "/cards", "", map[string]string{"name": "Card", "number": "10000006"}, nil); res.Code != http.StatusUnauthorized {
+			t.Fatalf("POST /cards = %d, want %d", res.Code, http.StatusUnauthorized)
+		}
+	})
+}
+
+func TestPatchCard(t *testing.T) {
+	s := newTestServer(t)
+	defer s.close()
+
+	s.user(t, "owner")
+	s.user(t, "reader")
+	s.user(t, "manager")
+	s.user(t, "stranger")
+
+	c := s.card(t, "owner", "20000001")
+	path := "/cards/" + c.ID
+
+	for _, m := range []struct{ email, permission string }{{"reader@example.com", "read"}, {"manager@example.com", "manage"}} {
+		if res := s.do(t, http.MethodPost, path+"/members", "owner", map[string]string{"email": m.email, "permission": m.permission}, nil); res.Code != http.StatusCreated {
+			t.Fatalf("POST members = %d, want %d", res.Code, http.StatusCreated)
+		}
+	}
+
+	tests := map[string]struct {
+		userID     string
+		status     int
+		permission tuc.CardPermission
+	}{
+		"owner":    {"owner", http.StatusOK, tuc.CardPermissionOwner},
+		"manager":  {"manager", http.StatusOK, tuc.CardPermissionManage},
+		"reader":   {"reader", http.StatusForbidden, ""},
+		"stranger": {"stranger", http.StatusNotFound, ""},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got tuc.Card
+
+			res := s.do(t, http.MethodPatch, path, tt.userID, map[string]string{"name": name}, &got)
+			if res.Code != tt.status {
+				t.Fatalf("PATCH = %d, want %d", res.Code, tt.status)
+			}
+
+			if tt.status == http.StatusOK && (got.Name != name || got.Permission != tt.permission) {
+				t.Fatalf("PATCH = %+v", got)
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		if res := s.do(t, http.MethodPatch, path, "owner", map[string]string{"name": ""}, nil); res.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("PATCH = %d, want %d", res.Code, http.StatusUnprocessableEntity)
+		}
+	})
+}
+
+func TestCardMembers(t *testing.T) {
+	s := newTestServer(t)
+	defer s.close()
+
+	s.user(t, "owner")
+	s.user(t, "member")
+
+	c := s.card(t, "owner", "30000001")
+	path := "/cards/" + c.ID + "/members"
+
+	t.Run("share", func(t *testing.T) {
+		var m tuc.CardMember
+
+		if res := s.do(t, http.MethodPost, path, "owner", map[string]string{"email": "member@example.com"}, &m); res.Code != http.StatusCreated {
+			t.Fatalf("POST = %d, want %d", res.Code, http.StatusCreated)
+		}
+
+		if m.Email != "member@example.com" || m.Permission != tuc.CardPermissionRead {
+			t.Fatalf("POST = %+v", m)
+		}
+
+		var cards []tuc.Card
+
+		if res := s.do(t, http.MethodGet, "/cards", "member", nil, &cards); res.Code != http.StatusOK {
+			t.Fatalf("GET /cards = %d, want %d", res.Code, http.StatusOK)
+		}
+
+		if len(cards) != 1 || cards[0].ID != c.ID || cards[0].Permission != tuc.CardPermissionRead {
+			t.Fatalf("GET /cards = %+v", cards)
+		}
+
+		var members []tuc.CardMember
+
+		if res := s.do(t, http.MethodGet, path, "owner", nil, &members); res.Code != http.StatusOK {
+			t.Fatalf("GET = %d, want %d", res.Code, http.StatusOK)
+		}
+
+		if len(members) != 1 || members[0].Email != "member@example.com" {
+			t.Fatalf("GET = %+v", members)
+		}
+	})
+
+	t.Run("only the owner shares and lists", func(t *testing.T) {
+		if res := s.do(t, http.MethodPost, path, "member", map[string]string{"email": "other@example.com"}, nil); res.Code != http.StatusForbidden {
+			t.Fatalf("POST = %d, want %d", res.Code, http.StatusForbidden)
+		}
+
+		if res := s.do(t, http.MethodGet, path, "member", nil, nil); res.Code != http.StatusForbidden {
+			t.Fatalf("GET = %d, want %d", res.Code, http.StatusForbidden)
+		}
+	})
+
+	invalid := map[string]map[string]string{
+		"own email":          {"email": "owner@example.com"},
+		"invalid email":      {"email": "member"},
+		"invalid permission": {"email": "member@example.com", "permission": "owner"},
+	}
+
+	for name, body := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if res := s.do(t, http.MethodPost, path, "owner", body, nil); res.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("POST = %d, want %d", res.Code, http.StatusUnprocessableEntity)
+			}
+		})
+	}
+
+	t.Run("member leaves", func(t *testing.T) {
+		if res := s.do(t, http.MethodDelete, path+"/member@example.com", "member", nil, nil); res.Code != http.StatusNoContent {
+			t.Fatalf("DELETE = %d, want %d", res.Code, http.StatusNoContent)
+		}
+
+		var cards []tuc.Card
+
+		if s.do(t, http.MethodGet, "/cards", "member", nil, &cards); len(cards) != 0 {
+			t.Fatalf("GET /cards = %+v, want no cards", cards)
+		}
+	})
+}
+
+func TestCardInvites(t *testing.T) {
+	ctx := context.Background()
+
+	s := newTestServer(t)
+	defer s.close()
+
+	s.user(t, "owner")
+
+	c := s.card(t, "owner", "40000001")
+	path := "/cards/" + c.ID + "/members"
+
+	// members lists the members of the card as its owner sees them
+	members := func(t *testing.T) []tuc.CardMember {
+		var members []tuc.CardMember
+
+		if res := s.do(t, http.MethodGet, path, "owner", nil, &members); res.Code != http.StatusOK {
+			t.Fatalf("GET = %d, want %d", res.Code, http.StatusOK)
+		}
+
+		return members
+	}
+
+	t.Run("invite", func(t *testing.T) {
+		var m tuc.CardMember
+
+		if res := s.do(t, http.MethodPost, path, "owner", map[string]string{"email": "new@example.com", "permission": "manage"}, &m); res.Code != http.StatusCreated {
+			t.Fatalf("POST = %d, want %d", res.Code, http.StatusCreated)
+		}
+
+		want := tuc.CardMember{Email: "new@example.com", Pending: true, Permission: tuc.CardPermissionManage}
+
+		if m != want {
+			t.Fatalf("POST = %+v, want %+v", m, want)
+		}
+
+		if u, _ := s.users.FindByEmail(ctx, "new@example.com"); u != nil {
+			t.Fatalf("FindByEmail = %+v, want no user", u)
+		}
+
+		if got := members(t); len(got) != 1 || got[0] != want {
+			t.Fatalf("GET = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("accepted at login", func(t *testing.T) {
+		if res := s.do(t, http.MethodPost, "/login/test", "", map[string]string{"token": "new@example.com"}, nil); res.Code != http.StatusOK {
+			t.Fatalf("POST /login/test = %d, want %d", res.Code, http.StatusOK)
+		}
+
+		u, err := s.users.FindByEmail(ctx, "new@example.com")
+		if err != nil || u == nil {
+			t.Fatalf("FindByEmail = %+v, %v", u, err)
+		}
+
+		var cards []tuc.Card
+
+		if s.do(t, http.MethodGet, "/cards", u.ID, nil, &cards); len(cards) != 1 || cards[0].ID != c.ID || cards[0].Permission != tuc.CardPermissionManage {
+			t.Fatalf("GET /cards = %+v", cards)
+		}
+
+		want := tuc.CardMember{Email: "new@example.com", Permission: tuc.CardPermissionManage}
+
+		if got := members(t); len(got) != 1 || got[0] != want {
+			t.Fatalf("GET = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("delete invite", func(t *testing.T) {
+		if res := s.do(t, http.MethodPost, path, "owner", map[string]string{"email": "gone@example.com"}, nil); res.Code != http.StatusCreated {
+			t.Fatalf("POST = %d, want %d", res.Code, http.StatusCreated)
+		}
+
+		if res := s.do(t, http.MethodDelete, path+"/gone@example.com", "owner", nil, nil); res.Code != http.StatusNoContent {
+			t.Fatalf("DELETE = %d, want %d", res.Code, http.StatusNoContent)
+		}
+
+		for _, m := range members(t) {
+			if m.Email == "gone@example.com" {
+				t.Fatalf("GET = %+v, want no invite for gone@example.com", m)
+			}
+		}
+	})
+
+	t.Run("deleted card", func(t *testing.T) {
+		d := s.card(t, "owner", "40000002")
+
+		if res := s.do(t, http.MethodPost, "/cards/"+d.ID+"/members", "owner", map[string]string{"email": "late@example.com"}, nil); res.Code != http.StatusCreated {
+			t.Fatalf("POST = %d, want %d", res.Code, http.StatusCreated)
+		}
+
+		if res := s.do(t, http.MethodDelete, "/cards/"+d.ID, "owner", nil, nil); res.Code != http.StatusNoContent {
+			t.Fatalf("DELETE = %d, want %d", res.Code, http.StatusNoContent)
+		}
+
+		if res := s.do(t, http.MethodPost, "/login/test", "", map[string]string{"token": "late@example.com"}, nil); res.Code != http.StatusOK {
+			t.Fatalf("POST /login/test = %d, want %d", res.Code, http.StatusOK)
+		}
+
+		if invites, _ := s.invites.ListByEmail(ctx, "late@example.com"); len(invites) != 0 {
+			t.Fatalf("ListByEmail = %+v, want no invites", invites)
+		}
+
+		u, _ := s.users.FindByEmail(ctx, "late@example.com")
+
+		var cards []tuc.Card
+
+		if s.do(t, http.MethodGet, "/cards", u.ID, nil, &cards); len(cards) != 0 {
+			t.Fatalf("GET /cards = %+v, want no cards", cards)
+		}
+	})
+
+	t.Run("registered again", func(t *testing.T) {
+		d := s.card(t, "owner", "40000003")
+		path := "/cards/" + d.ID
+
+		if res := s.do(t, http.MethodPost, path+"/members", "owner", map[string]string{"email": "old@example.com"}, nil); res.Code != http.StatusCreated {
+			t.Fatalf("POST = %d, want %d", res.Code, http.StatusCreated)
+		}
+
+		// records an event
+		s.upstream.SetBalance("40000003", 5)
+
+		if res := s.do(t, http.MethodGet, path+"/balance", "owner", nil, nil); res.Code != http.StatusOK {
+			t.Fatalf("GET /balance = %d, want %d", res.Code, http.StatusOK)
+		}
+
+		if res := s.do(t, http.MethodDelete, path, "owner", nil, nil); res.Code != http.StatusNoContent {
+			t.Fatalf("DELETE = %d, want %d", res.Code, http.StatusNoContent)
+		}
+
+		if again := s.card(t, "owner", "40000003"); again.ID != d.ID {
+			t.Fatalf("POST /cards = %s, want the same id %s", again.ID, d.ID)
+		}
+
+		if invites, _ := s.invites.ListByEmail(ctx, "old@example.com"); len(invites) != 0 {
+			t.Fatalf("ListByEmail = %+v, want no invites", invites)
+		}
+
+		var history struct {
+			Snapshots []tuc.BalanceSnapshot `json:"snapshots"`
+		}
+
+		if s.do(t, http.MethodGet, path+"/history", "owner", nil, &history); len(history.Snapshots) != 1 || history.Snapshots[0].Balance != 10 {
+			t.Fatalf("GET /history = %+v, want the snapshot of the new card", history.Snapshots)
+		}
+
+		var events struct {
+			Events []tuc.CardEvent `json:"events"`
+		}
+
+		if s.do(t, http.MethodGet, path+"/events", "owner", nil, &events); len(events.Events) != 0 {
+			t.Fatalf("GET /events = %+v, want no events", events.Events)
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/apex/log"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"github.com/tj/go/http/response"
+
+	"github.com/nerdify/tuc"
+)
+
+// revocationCacheTTL is how long revocations are cached, and so how long a
+// logout on another instance takes to be seen.
+const revocationCacheTTL = 30 * time.Second
+
+// checkRevoked rejects revoked access tokens. It runs after the token is
+// verified.
+func (a *Authenticator) checkRevoked(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.revocations == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userID := getUserID(r)
+		rev, err := a.findRevocation(r, userID)
+
+		if err != nil {
+			log.WithError(err).WithField("user", userID).Error("loading revocation")
+			response.InternalServerError(w)
+			return
+		}
+
+		if rev != nil && rev.Revoked(getSessionID(r), getIssuedAt(r)) {
+			log.WithField("user", userID).Warn("revoked token")
+			response.Unauthorized(w)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// findRevocation returns the cached revocation of a user.
+func (a *Authenticator) findRevocation(r *http.Request, userID string) (*tuc.Revocation, error) {
+	key := revocationCacheKey(userID)
+
+	if v, found := cache.Get(key); found {
+		return v.(*tuc.Revocation), nil
+	}
+
+	rev, err := a.revocations.Find(r.Context(), userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cache.Set(key, rev, revocationCacheTTL)
+
+	return rev, nil
+}
+
+func revocationCacheKey(userID string) string {
+	return "revocation:" + userID
+}
+
+func (h *AuthHandler) handleLogout(w http.ResponseWriter, r *http.Request) {
+	sessionID := getSessionID(r)
+
+	// tokens issued before sessions only end by logging out everywhere
+	if sessionID == "" {
+		h.handleLogoutAll(w, r)
+		return
+	}
+
+	userID := getUserID(r)
+	l := log.WithField("user", userID).WithField("family", sessionID)
+
+	if err := h.RefreshTokenService.Revoke(r.Context(), sessionID); err != nil {
+		l.WithError(err).Error("revoking refresh token")
+		response.InternalServerError(w)
+		return
+	}
+
+	if err := h.auth.revokeSession(r.Context(), userID, sessionID); err != nil {
+		l.WithError(err).Error("revoking session")
+		response.InternalServerError(w)
+		return
+	}
+
+	response.NoContent(w)
+}
+
+func (h *AuthHandler) handleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r)
+
+	if err := h.auth.revokeAll(r.Context(), h.RefreshTokenService, userID); err != nil {
+		log.WithError(err).WithField("user", userID).Error("revoking tokens")
+		response.InternalServerError(w)
+		return
+	}
+
+	response.NoContent(w)
+}
+
+// revokeSession revokes the access tokens of a session.
+func (a *Authenticator) revokeSession(ctx context.Context, userID, sessionID string) error {
+	if a.revocations == nil {
+		return nil
+	}
+
+	// every token of the session expires within accessTokenTTL
+	if err := a.revocations.RevokeSession(ctx, userID, sessionID, time.Now().Add(accessTokenTTL)); err != nil {
+		return err
+	}
+
+	cache.Delete(revocationCacheKey(userID))
+
+	return nil
+}
+
+// revokeAll revokes every refresh and access token of a user.
+func (a *Authenticator) revokeAll(ctx context.Context, s tuc.RefreshTokenService, userID string) error {
+	if err := s.RevokeUser(ctx, userID); err != nil {
+		return errors.Wrap(err, "revoking refresh tokens")
+	}
+
+	if a.revocations == nil {
+		return nil
+	}
+
+	now := time.Now()
+
+	if err := a.revocations.RevokeAll(ctx, userID, now, now.Add(accessTokenTTL)); err != nil {
+		return errors.Wrap(err, "revoking access tokens")
+	}
+
+	cache.Delete(revocationCacheKey(userID))
+
+	return nil
+}
+
+// getSessionID returns the session of the access token, empty for tokens
+// issued before tokens had one.
+func getSessionID(r *http.Request) string {
+	token := r.Context().Value("token").(*jwt.Token)
+	sid, _ := token.Claims.(jwt.MapClaims)["sid"].(string)
+
+	return sid
+}
+
+// getIssuedAt returns when the access token was issued.
+func getIssuedAt(r *http.Request) time.Time {
+	token := r.Context().Value("token").(*jwt.Token)
+	iat, _ := token.Claims.(jwt.MapClaims)["iat"].(float64)
+
+	return time.Unix(int64(iat), 0)
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+
+	"github.com/nerdify/tuc"
+	"github.com/nerdify/tuc/fare"
+	"github.com/nerdify/tuc/memory"
+)
+
+func TestLogout(t *testing.T) {
+	tests := map[string]struct {
+		revocations tuc.RevocationService
+		status      int
+	}{
+		"revoked":        {&memory.RevocationService{}, http.StatusUnauthorized},
+		"no revocations": {nil, http.StatusOK},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t)
+			defer s.close()
+
+			s.auth = NewAuthenticator(s.auth.keyset, tt.revocations)
+			s.router = mux.NewRouter()
+
+			ah := NewAuthHandler(s.router, s.auth)
+			ah.RefreshTokenService = &memory.RefreshTokenService{}
+			ah.UserService = s.users
+
+			ch := NewCardHandler(s.router, s.auth)
+			ch.CardService = s.cards
+			ch.Fares = fare.Default()
+
+			// issued a second earlier, since iat is in whole seconds
+			now := time.Now()
+			token, err := s.auth.keyset.Sign(&accessClaims{
+				StandardClaims: jwt.StandardClaims{
+					ExpiresAt: now.Add(accessTokenTTL).Unix(),
+					IssuedAt:  now.Add(-time.Second).Unix(),
+					Subject:   "a",
+				},
+			})
+			if err != nil {
+				t.Fatalf("signing token: %v", err)
+			}
+
+			if res := s.do(t, http.MethodPost, "/logout/all", "a", nil, nil); res.Code != http.StatusNoContent {
+				t.Fatalf("POST /logout/all = %d, want %d", res.Code, http.StatusNoContent)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/cards", nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+
+			w := httptest.NewRecorder()
+			s.router.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("GET /cards = %d, want %d", w.Code, tt.status)
+			}
+
+			// logging in again right away, likely in the same second
+			if res := s.do(t, http.MethodGet, "/cards", "a", nil, nil); res.Code != http.StatusOK {
+				t.Fatalf("GET /cards after logging in again = %d, want %d", res.Code, http.StatusOK)
+			}
+		})
+	}
+}
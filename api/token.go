@@ -0,0 +1,186 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	"github.com/tj/go/http/response"
+
+	"github.com/nerdify/tuc"
+)
+
+// Lifetimes of issued tokens. Refresh tokens expire when unused for
+// refreshTokenTTL.
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// accessClaims are the claims of an access token. The session is the refresh
+// token family the token was issued with, so logging out revokes both.
+type accessClaims struct {
+	jwt.StandardClaims
+	SessionID string `json:"sid,omitempty"`
+}
+
+// tokens are the tokens issued on login and refresh.
+type tokens struct {
+	AccessToken  string `json:"token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (h *AuthHandler) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.WithError(err).Error("parsing body")
+		response.BadRequest(w)
+		return
+	}
+
+	familyID, secret := splitRefreshToken(body.RefreshToken)
+
+	if familyID == "" || secret == "" {
+		log.Warn("malformed refresh token")
+		response.Unauthorized(w)
+		return
+	}
+
+	l := log.WithField("family", familyID)
+
+	nextHash, nextSecret, err := newRefreshSecret()
+
+	if err != nil {
+		l.WithError(err).Error("generating refresh token")
+		response.InternalServerError(w)
+		return
+	}
+
+	rt, err := h.RefreshTokenService.Rotate(r.Context(), familyID, hashSecret(secret), nextHash, time.Now().Add(refreshTokenTTL))
+
+	if err == tuc.ErrRefreshTokenReused {
+		l.Warn("refresh token reused, family revoked")
+		response.Unauthorized(w)
+		return
+	}
+
+	if err == tuc.ErrInvalidRefreshToken {
+		l.Warn("invalid refresh token")
+		response.Unauthorized(w)
+		return
+	}
+
+	if err != nil {
+		l.WithError(err).Error("rotating refresh token")
+		response.InternalServerError(w)
+		return
+	}
+
+	access, err := h.auth.generateAccessToken(rt.UserID, familyID)
+
+	if err != nil {
+		l.WithError(err).Error("signed token")
+		response.InternalServerError(w)
+		return
+	}
+
+	response.OK(w, &tokens{
+		AccessToken:  access,
+		ExpiresIn:    int64(accessTokenTTL / time.Second),
+		RefreshToken: familyID + "." + nextSecret,
+	})
+}
+
+// issueTokens issues an access token and starts a refresh token family for
+// the user.
+func (h *AuthHandler) issueTokens(ctx context.Context, userID string) (*tokens, error) {
+	familyID := uuid.NewV4().String()
+	access, err := h.auth.generateAccessToken(userID, familyID)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "signing access token")
+	}
+
+	hash, secret, err := newRefreshSecret()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "generating refresh token")
+	}
+
+	now := time.Now().UTC()
+	rt := &tuc.RefreshToken{
+		CreatedAt: now,
+		ExpiresAt: now.Add(refreshTokenTTL),
+		FamilyID:  familyID,
+		Hash:      hash,
+		UserID:    userID,
+	}
+
+	if err := h.RefreshTokenService.Create(ctx, rt); err != nil {
+		return nil, errors.Wrap(err, "creating refresh token")
+	}
+
+	return &tokens{
+		AccessToken:  access,
+		ExpiresIn:    int64(accessTokenTTL / time.Second),
+		RefreshToken: rt.FamilyID + "." + secret,
+	}, nil
+}
+
+func (a *Authenticator) generateAccessToken(userID, sessionID string) (string, error) {
+	now := time.Now()
+
+	return a.keyset.Sign(&accessClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: now.Add(accessTokenTTL).Unix(),
+			IssuedAt:  now.Unix(),
+			Issuer:    "saldotuc.com",
+			Subject:   userID,
+		},
+		SessionID: sessionID,
+	})
+}
+
+// newRefreshSecret returns a random refresh token secret and its hash.
+func newRefreshSecret() (hash, secret string, err error) {
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	secret = base64.RawURLEncoding.EncodeToString(b)
+
+	return hashSecret(secret), secret, nil
+}
+
+// hashSecret returns the hash a refresh token secret is stored by.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// splitRefreshToken splits a refresh token into its family id and secret.
+func splitRefreshToken(token string) (familyID, secret string) {
+	i := strings.IndexByte(token, '.')
+
+	if i < 0 {
+		return "", ""
+	}
+
+	return token[:i], token[i+1:]
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// login logs in through the test provider.
+func (s *testServer) login(t *testing.T, email string) *tokens {
+	t.Helper()
+
+	var tok tokens
+
+	if res := s.do(t, http.MethodPost, "/login/test", "", map[string]string{"token": email}, &tok); res.Code != http.StatusOK {
+		t.Fatalf("POST /login/test = %d, want %d", res.Code, http.StatusOK)
+	}
+
+	return &tok
+}
+
+// refresh refreshes a refresh token.
+func (s *testServer) refresh(t *testing.T, token string) (*tokens, int) {
+	t.Helper()
+
+	var tok tokens
+
+	res := s.do(t, http.MethodPost, "/token/refresh", "", map[string]string{"refresh_token": token}, &tok)
+
+	return &tok, res.Code
+}
+
+func TestRefreshToken(t *testing.T) {
+	t.Run("rotation", func(t *testing.T) {
+		s := newTestServer(t)
+		defer s.close()
+
+		first := s.login(t, "a@example.com")
+
+		second, status := s.refresh(t, first.RefreshToken)
+		if status != http.StatusOK {
+			t.Fatalf("POST /token/refresh = %d, want %d", status, http.StatusOK)
+		}
+
+		familyID, _ := splitRefreshToken(first.RefreshToken)
+
+		if second.RefreshToken == first.RefreshToken || !strings.HasPrefix(second.RefreshToken, familyID+".") {
+			t.Fatalf("refresh token = %q, want a new secret of family %s", second.RefreshToken, familyID)
+		}
+
+		if second.AccessToken == "" || second.ExpiresIn != int64(accessTokenTTL.Seconds()) {
+			t.Fatalf("POST /token/refresh = %+v", second)
+		}
+
+		if _, status := s.refresh(t, second.RefreshToken); status != http.StatusOK {
+			t.Fatalf("POST /token/refresh = %d, want %d", status, http.StatusOK)
+		}
+	})
+
+	t.Run("reuse revokes the family", func(t *testing.T) {
+		s := newTestServer(t)
+		defer s.close()
+
+		first := s.login(t, "a@example.com")
+
+		second, status := s.refresh(t, first.RefreshToken)
+		if status != http.StatusOK {
+			t.Fatalf("POST /token/refresh = %d, want %d", status, http.StatusOK)
+		}
+
+		if _, status := s.refresh(t, first.RefreshToken); status != http.StatusUnauthorized {
+			t.Fatalf("POST /token/refresh reused = %d, want %d", status, http.StatusUnauthorized)
+		}
+
+		if _, status := s.refresh(t, second.RefreshToken); status != http.StatusUnauthorized {
+			t.Fatalf("POST /token/refresh after reuse = %d, want %d", status, http.StatusUnauthorized)
+		}
+	})
+
+	malformed := map[string]string{
+		"empty":          "",
+		"no separator":   "token",
+		"no family":      ".secret",
+		"no secret":      "family.",
+		"unknown family": "family.secret",
+	}
+
+	for name, token := range malformed {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t)
+			defer s.close()
+
+			if _, status := s.refresh(t, token); status != http.StatusUnauthorized {
+				t.Fatalf("POST /token/refresh = %d, want %d", status, http.StatusUnauthorized)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"github.com/apex/log"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	"github.com/tj/go/http/response"
+
+	"github.com/nerdify/tuc"
+)
+
+// UserHandler handles communication with the User related methods.
+type UserHandler struct {
+	EmailChangeService  tuc.EmailChangeService
+	RefreshTokenService tuc.RefreshTokenService
+	UserService         tuc.UserService
+
+	auth *Authenticator
+}
+
+// NewUserHandler returns a new instance of UserHandler, authenticating
+// requests with a.
+func NewUserHandler(r *mux.Router, a *Authenticator) *UserHandler {
+	h := &UserHandler{
+		auth: a,
+	}
+
+	// followed from the emails of an email change
+	r.HandleFunc("/email/confirm", h.handleConfirmEmail).Methods(http.MethodGet)
+	r.HandleFunc("/email/cancel", h.handleCancelEmail).Methods(http.MethodGet)
+
+	s := r.PathPrefix("/me").Subrouter()
+	s.Use(a.Authenticate)
+	s.HandleFunc("/notifications", h.handleGetNotifications).Methods(http.MethodGet)
+	s.HandleFunc("/notifications", h.handlePutNotifications).Methods(http.MethodPut)
+	s.HandleFunc("/email", h.handlePostEmail).Methods(http.MethodPost)
+
+	return h
+}
+
+func (h *UserHandler) handleGetNotifications(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r)
+	u, err := h.UserService.Find(r.Context(), userID)
+
+	if err != nil {
+		log.WithError(err).Error("loading user")
+		response.InternalServerError(w)
+		return
+	}
+
+	if u == nil {
+		log.WithField("user", userID).Warn("user does not exist")
+		response.NotFound(w)
+		return
+	}
+
+	response.OK(w, u.Preferences())
+}
+
+func (h *UserHandler) handlePutNotifications(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r)
+	body := tuc.DefaultNotificationPreferences
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.WithError(err).Error("parsing body")
+		response.BadRequest(w)
+		return
+	}
+
+	if err := validateNotifications(&body); err != nil {
+		log.Error("invalid request")
+		response.JSON(w, map[string]string{"message": err.Error()}, http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := h.UserService.UpdateNotifications(r.Context(), userID, &body); err != nil {
+		log.WithError(err).Error("updating notifications")
+		response.InternalServerError(w)
+		return
+	}
+
+	response.OK(w, body)
+}
+
+func validateNotifications(p *tuc.NotificationPreferences) error {
+	timeOfDay := regexp.MustCompile("^([01]\\d|2[0-3]):[0-5]\\d$")
+
+	if p.Language != "es" && p.Language != "en" {
+		return errors.New("El idioma debe ser es o en")
+	} else if (p.QuietHoursStart == "") != (p.QuietHoursEnd == "") {
+		return errors.New("Las horas de silencio requieren inicio y fin")
+	} else if p.QuietHoursStart != "" && (!timeOfDay.MatchString(p.QuietHoursStart) || !timeOfDay.MatchString(p.QuietHoursEnd)) {
+		return errors.New("Las horas de silencio deben tener el formato HH:MM")
+	}
+
+	return nil
+}
+
+// validEmail reports whether email looks like an email address.
+func validEmail(email string) bool {
+	m, _ := regexp.MatchString(`^[^@\s]+@[^@\s]+$`, email)
+	return m
+}
+
+// findOrCreateUser returns the user with an email, creating it with the
+// given identities when there is none.
+func findOrCreateUser(ctx context.Context, s tuc.UserService, email string, identities map[string]string) (*tuc.User, error) {
+	u, err := s.FindByEmail(ctx, email)
+
+	if err != nil || u != nil {
+		return u, err
+	}
+
+	u = &tuc.User{
+		Email:      email,
+		ID:         uuid.NewV4().String(),
+		Identities: identities,
+	}
+
+	err = s.Create(ctx, u)
+
+	// created meanwhile
+	if err == tuc.ErrEmailTaken {
+		return s.FindByEmail(ctx, email)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/apex/log"
+	uuid "github.com/satori/go.uuid"
+	"github.com/tj/go/http/response"
+
+	"github.com/nerdify/tuc"
+)
+
+const (
+	// emailChangeTTL is how long the new email has to confirm a change.
+	emailChangeTTL = 24 * time.Hour
+
+	// emailChangeCancelTTL is how long the old email can revert a confirmed
+	// change.
+	emailChangeCancelTTL = 7 * 24 * time.Hour
+)
+
+func (h *UserHandler) handlePostEmail(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.WithError(err).Error("parsing body")
+		response.BadRequest(w)
+		return
+	}
+
+	if !validEmail(body.Email) {
+		log.Error("invalid request")
+		response.JSON(w, map[string]string{"message": "El correo electrónico no es válido"}, http.StatusUnprocessableEntity)
+		return
+	}
+
+	userID := getUserID(r)
+	l := log.WithField("user", userID)
+	u, err := h.UserService.Find(r.Context(), userID)
+
+	if err != nil {
+		l.WithError(err).Error("loading user")
+		response.InternalServerError(w)
+		return
+	}
+
+	if u == nil {
+		l.Warn("user does not exist")
+		response.NotFound(w)
+		return
+	}
+
+	if u.Email == body.Email {
+		response.JSON(w, map[string]string{"message": "El correo electrónico ya es el de tu cuenta"}, http.StatusUnprocessableEntity)
+		return
+	}
+
+	other, err := h.UserService.FindByEmail(r.Context(), body.Email)
+
+	if err != nil {
+		l.WithError(err).Error("loading user")
+		response.InternalServerError(w)
+		return
+	}
+
+	if other != nil {
+		response.Conflict(w, map[string]string{"message": "El correo electrónico ya está en uso"})
+		return
+	}
+
+	change := &tuc.EmailChange{
+		CancelToken:  uuid.NewV4().String(),
+		ConfirmToken: uuid.NewV4().String(),
+		ExpiresAt:    time.Now().Add(emailChangeTTL),
+		NewEmail:     body.Email,
+		OldEmail:     u.Email,
+		UserID:       userID,
+	}
+
+	err = h.EmailChangeService.Create(r.Context(), change)
+
+	// the old email can still cancel the last change
+	if err == tuc.ErrEmailChangePending {
+		response.Conflict(w, map[string]string{"message": "Hay un cambio de correo electrónico pendiente"})
+		return
+	}
+
+	if err != nil {
+		l.WithError(err).Error("creating email change")
+		response.InternalServerError(w)
+		return
+	}
+
+	response.Accepted(w, map[string]string{"email": body.Email})
+}
+
+func (h *UserHandler) handleConfirmEmail(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user")
+	token := r.URL.Query().Get("token")
+
+	if userID == "" || token == "" {
+		response.BadRequest(w)
+		return
+	}
+
+	l := log.WithField("user", userID)
+	change, err := h.EmailChangeService.Confirm(r.Context(), userID, token, time.Now().Add(emailChangeCancelTTL))
+
+	if err == tuc.ErrInvalidEmailChange {
+		l.WithError(err).Warn("confirming email change")
+		response.Unauthorized(w)
+		return
+	}
+
+	if err != nil {
+		l.WithError(err).Error("confirming email change")
+		response.InternalServerError(w)
+		return
+	}
+
+	err = h.UserService.ChangeEmail(r.Context(), userID, change.NewEmail)
+
+	// a change which can't complete must not block the next one
+	if err != nil {
+		if _, err := h.EmailChangeService.Cancel(r.Context(), userID, change.CancelToken); err != nil {
+			l.WithError(err).Error("cancelling email change")
+		}
+	}
+
+	// taken since the change started
+	if err == tuc.ErrEmailTaken {
+		response.Conflict(w, map[string]string{"message": "El correo electrónico ya está en uso"})
+		return
+	}
+
+	if err != nil {
+		l.WithError(err).Error("changing email")
+		response.InternalServerError(w)
+		return
+	}
+
+	renderMessage(w, "Dirección de correo electrónico confirmada", "Tu cuenta ahora usa "+change.NewEmail+". ¡Puedes cerrar esta ventana y regresar a la aplicación!")
+}
+
+func (h *UserHandler) handleCancelEmail(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user")
+	token := r.URL.Query().Get("token")
+
+	if userID == "" || token == "" {
+		response.BadRequest(w)
+		return
+	}
+
+	l := log.WithField("user", userID)
+	change, err := h.EmailChangeService.Cancel(r.Context(), userID, token)
+
+	if err == tuc.ErrInvalidEmailChange {
+		l.WithError(err).Warn("cancelling email change")
+		response.Unauthorized(w)
+		return
+	}
+
+	if err != nil {
+		l.WithError(err).Error("cancelling email change")
+		response.InternalServerError(w)
+		return
+	}
+
+	if !change.Confirmed {
+		renderMessage(w, "Cambio de correo electrónico cancelado", "Tu cuenta sigue usando "+change.OldEmail+".")
+		return
+	}
+
+	// whoever confirmed the change must not keep the account
+	if err := h.UserService.ChangeEmail(r.Context(), userID, change.OldEmail); err != nil {
+		l.WithError(err).Error("reverting email")
+		response.InternalServerError(w)
+		return
+	}
+
+	if err := h.auth.revokeAll(r.Context(), h.RefreshTokenService, userID); err != nil {
+		l.WithError(err).Error("revoking tokens")
+		response.InternalServerError(w)
+		return
+	}
+
+	renderMessage(w, "Cambio de correo electrónico cancelado", "Tu cuenta vuelve a usar "+change.OldEmail+" y se cerraron todas sus sesiones.")
+}
+
+// renderMessage renders a page with a title and a text.
+func renderMessage(w http.ResponseWriter, title, text string) {
+	t := template.Must(template.New("").Parse(views.String("message.html")))
+
+	t.Execute(w, map[string]string{
+		"Text":  text,
+		"Title": title,
+	})
+}
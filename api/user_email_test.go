@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc"
+	"github.com/nerdify/tuc/memory"
+)
+
+// failingUserService fails to change emails.
+type failingUserService struct {
+	tuc.UserService
+}
+
+func (failingUserService) ChangeEmail(ctx context.Context, id, email string) error {
+	return errors.New("unavailable")
+}
+
+func TestConfirmEmail(t *testing.T) {
+	tests := map[string]struct {
+		token  string
+		taken  bool
+		fail   bool
+		status int
+		email  string
+	}{
+		"confirmed":     {token: "confirm", status: http.StatusOK, email: "new@example.com"},
+		"invalid token": {token: "other", status: http.StatusUnauthorized, email: "old@example.com"},
+		"taken":         {token: "confirm", taken: true, status: http.StatusConflict, email: "old@example.com"},
+		"failure":       {token: "confirm", fail: true, status: http.StatusInternalServerError, email: "old@example.com"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			users := &memory.UserService{}
+
+			h := &UserHandler{
+				EmailChangeService: &memory.EmailChangeService{},
+				UserService:        users,
+			}
+
+			if err := users.Create(ctx, &tuc.User{Email: "old@example.com", ID: "a"}); err != nil {
+				t.Fatalf("creating user: %v", err)
+			}
+
+			if tt.taken {
+				if err := users.Create(ctx, &tuc.User{Email: "new@example.com", ID: "b"}); err != nil {
+					t.Fatalf("creating user: %v", err)
+				}
+			}
+
+			if tt.fail {
+				h.UserService = failingUserService{users}
+			}
+
+			change := &tuc.EmailChange{
+				CancelToken:  "cancel",
+				ConfirmToken: "confirm",
+				ExpiresAt:    time.Now().Add(emailChangeTTL),
+				NewEmail:     "new@example.com",
+				OldEmail:     "old@example.com",
+				UserID:       "a",
+			}
+
+			if err := h.EmailChangeService.Create(ctx, change); err != nil {
+				t.Fatalf("creating email change: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			h.handleConfirmEmail(w, httptest.NewRequest(http.MethodGet, "/email/confirm?user=a&token="+tt.token, nil))
+
+			if w.Code != tt.status {
+				t.Fatalf("GET /email/confirm = %d, want %d", w.Code, tt.status)
+			}
+
+			u, err := users.Find(ctx, "a")
+			if err != nil {
+				t.Fatalf("Find: %v", err)
+			}
+
+			if u.Email != tt.email {
+				t.Fatalf("Email = %q, want %q", u.Email, tt.email)
+			}
+
+			// a new change is blocked only by a completed one
+			change.ConfirmToken = "retry"
+
+			err = h.EmailChangeService.Create(ctx, change)
+			if tt.status == http.StatusOK && err != tuc.ErrEmailChangePending {
+				t.Fatalf("Create = %v, want %v", err, tuc.ErrEmailChangePending)
+			}
+
+			if tt.status != http.StatusOK && err != nil {
+				t.Fatalf("Create = %v, want a retry", err)
+			}
+		})
+	}
+}
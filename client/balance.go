@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Errors returned for upstream responses.
+var (
+	ErrCardNotFound      = errors.New("card not found")
+	ErrCardBlocked       = errors.New("card blocked")
+	ErrUpstreamMalformed = errors.New("malformed upstream response")
+)
+
+// codeNotFound is the upstream code for an unknown card.
+const codeNotFound = 2
+
+// CardStatus is the normalized status of a card.
+type CardStatus int
+
+// Card statuses.
+const (
+	CardStatusUnknown CardStatus = iota
+	CardStatusActive
+	CardStatusBlocked
+)
+
+// String returns the name of the status.
+func (s CardStatus) String() string {
+	switch s {
+	case CardStatusActive:
+		return "active"
+	case CardStatusBlocked:
+		return "blocked"
+	default:
+		return "unknown"
+	}
+}
+
+// parseCardStatus normalizes an upstream status.
+func parseCardStatus(s string) CardStatus {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "activo", "activa":
+		return CardStatusActive
+	case "bloqueado", "bloqueada":
+		return CardStatusBlocked
+	default:
+		return CardStatusUnknown
+	}
+}
+
+// Balance is the balance of a card.
+type Balance struct {
+	Balance float64
+	Status  CardStatus
+}
+
+// Result converts the raw output into a Balance. It returns ErrCardNotFound
+// for unknown cards, ErrCardBlocked for blocked cards and
+// ErrUpstreamMalformed when the output has no data.
+func (o *RequestOutput) Result() (*Balance, error) {
+	if o.Code == codeNotFound {
+		return nil, ErrCardNotFound
+	}
+
+	if len(o.Data) == 0 {
+		return nil, ErrUpstreamMalformed
+	}
+
+	b := &Balance{
+		Balance: o.Data[0].Balance,
+		Status:  parseCardStatus(o.Data[0].Status),
+	}
+
+	if b.Status == CardStatusBlocked {
+		return nil, ErrCardBlocked
+	}
+
+	return b, nil
+}
+
+// Balance gets the balance for the given card number.
+func (c *Client) Balance(ctx context.Context, card string) (*Balance, error) {
+	out, err := c.GetBalance(ctx, &RequestInput{
+		Card: card,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Result()
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestResult(t *testing.T) {
+	tests := map[string]struct {
+		output string
+		want   *Balance
+		err    error
+	}{
+		"active": {
+			output: `{"code": 0, "data": [{"balance": "10.50", "status": "Activo"}]}`,
+			want:   &Balance{Balance: 10.5, Status: CardStatusActive},
+		},
+		"active, feminine": {
+			output: `{"code": 0, "data": [{"balance": "10.50", "status": "activa"}]}`,
+			want:   &Balance{Balance: 10.5, Status: CardStatusActive},
+		},
+		"status with case and spaces": {
+			output: `{"code": 0, "data": [{"balance": "3", "status": "  ACTIVO "}]}`,
+			want:   &Balance{Balance: 3, Status: CardStatusActive},
+		},
+		"unknown status": {
+			output: `{"code": 0, "data": [{"balance": "3", "status": "Suspendido"}]}`,
+			want:   &Balance{Balance: 3, Status: CardStatusUnknown},
+		},
+		"empty status": {
+			output: `{"code": 0, "data": [{"balance": "3", "status": ""}]}`,
+			want:   &Balance{Balance: 3, Status: CardStatusUnknown},
+		},
+		"first of many": {
+			output: `{"code": 0, "data": [{"balance": "1", "status": "Activo"}, {"balance": "2", "status": "Bloqueado"}]}`,
+			want:   &Balance{Balance: 1, Status: CardStatusActive},
+		},
+		"blocked": {
+			output: `{"code": 0, "data": [{"balance": "10", "status": "Bloqueado"}]}`,
+			err:    ErrCardBlocked,
+		},
+		"blocked, feminine": {
+			output: `{"code": 0, "data": [{"balance": "10", "status": " bloqueada"}]}`,
+			err:    ErrCardBlocked,
+		},
+		"not found": {
+			output: `{"code": 2, "data": []}`,
+			err:    ErrCardNotFound,
+		},
+		"not found with data": {
+			output: `{"code": 2, "data": [{"balance": "10", "status": "Activo"}]}`,
+			err:    ErrCardNotFound,
+		},
+		"empty data": {
+			output: `{"code": 0, "data": []}`,
+			err:    ErrUpstreamMalformed,
+		},
+		"no data": {
+			output: `{"code": 0}`,
+			err:    ErrUpstreamMalformed,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var o RequestOutput
+
+			if err := json.Unmarshal([]byte(tt.output), &o); err != nil {
+				t.Fatalf("unmarshaling output: %v", err)
+			}
+
+			got, err := o.Result()
+			if err != tt.err {
+				t.Fatalf("Result error = %v, want %v", err, tt.err)
+			}
+
+			if tt.want == nil {
+				if got != nil {
+					t.Fatalf("Result = %+v, want nil", got)
+				}
+
+				return
+			}
+
+			if got == nil || *got != *tt.want {
+				t.Fatalf("Result = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
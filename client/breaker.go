@@ -0,0 +1,133 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// State is the state of a Breaker.
+type State int
+
+// Breaker states.
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker is a circuit breaker which opens after Threshold consecutive
+// failures and lets a single trial request through once Cooldown elapses.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	state    State
+	trial    bool
+}
+
+// NewBreaker returns a new instance of Breaker.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		Threshold: threshold,
+		Cooldown:  cooldown,
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.current()
+}
+
+// RetryAfter returns how long until the breaker lets a request through, or
+// zero when it is not open.
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.current() != StateOpen {
+		return 0
+	}
+
+	return b.Cooldown - time.Since(b.openedAt)
+}
+
+// allow reports whether a request may be made.
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.current() {
+	case StateOpen:
+		return false
+	case StateHalfOpen:
+		if b.trial {
+			return false
+		}
+
+		b.trial = true
+	}
+
+	return true
+}
+
+// success records a successful request, closing the breaker.
+func (b *Breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.state = StateClosed
+	b.trial = false
+}
+
+// failure records a failed request, opening the breaker when the threshold
+// is reached or the trial request failed.
+func (b *Breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+
+	if b.current() == StateHalfOpen || b.failures >= b.Threshold {
+		b.state = StateOpen
+		b.openedAt = time.Now()
+		b.trial = false
+	}
+}
+
+// abort records a request which ended without an outcome, letting another
+// trial request through.
+func (b *Breaker) abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+// current returns the state, moving an open breaker to half-open once the
+// cooldown has elapsed. It must be called with mu held.
+func (b *Breaker) current() State {
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.Cooldown {
+		b.state = StateHalfOpen
+	}
+
+	return b.state
+}
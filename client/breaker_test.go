@@ -0,0 +1,177 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc/client/fake"
+)
+
+const cooldown = 50 * time.Millisecond
+
+// open fails requests until the breaker of c opens.
+func open(t *testing.T, c *Client, upstream *fake.Server) {
+	t.Helper()
+
+	for i := 0; i < c.Breaker.Threshold; i++ {
+		upstream.Script("1", fake.Step{Status: 500})
+
+		if _, err := c.GetBalance(context.Background(), &RequestInput{Card: "1"}); err == nil {
+			t.Fatal("GetBalance succeeded, want an error")
+		}
+	}
+
+	if got := c.Breaker.State(); got != StateOpen {
+		t.Fatalf("State = %v, want %v", got, StateOpen)
+	}
+}
+
+func newBreakerClient(url string) *Client {
+	c := newClient(url)
+	c.Breaker = NewBreaker(2, cooldown)
+	c.MaxRetries = 0
+
+	return c
+}
+
+func TestBreaker(t *testing.T) {
+	ctx := context.Background()
+	in := &RequestInput{Card: "1"}
+
+	t.Run("opens after threshold failures", func(t *testing.T) {
+		upstream, requests, s := newUpstream()
+		defer s.Close()
+
+		c := newBreakerClient(s.URL)
+		open(t, c, upstream)
+
+		if _, err := c.GetBalance(ctx, in); err != ErrCircuitOpen {
+			t.Fatalf("GetBalance = %v, want %v", err, ErrCircuitOpen)
+		}
+
+		if n := requests.count(); n != 2 {
+			t.Fatalf("got %d requests, want 2", n)
+		}
+
+		if d := c.Breaker.RetryAfter(); d <= 0 || d > cooldown {
+			t.Fatalf("RetryAfter = %v, want it in (0, %v]", d, cooldown)
+		}
+	})
+
+	t.Run("success resets failures", func(t *testing.T) {
+		upstream, _, s := newUpstream()
+		defer s.Close()
+
+		c := newBreakerClient(s.URL)
+		upstream.Script("1", fake.Step{Status: 500}, fake.Step{}, fake.Step{Status: 500})
+
+		for i := 0; i < 3; i++ {
+			c.GetBalance(ctx, in)
+		}
+
+		if got := c.Breaker.State(); got != StateClosed {
+			t.Fatalf("State = %v, want %v", got, StateClosed)
+		}
+	})
+
+	t.Run("half-open lets a single trial through", func(t *testing.T) {
+		upstream, requests, s := newUpstream()
+		defer s.Close()
+
+		c := newBreakerClient(s.URL)
+		open(t, c, upstream)
+		time.Sleep(cooldown)
+
+		if got := c.Breaker.State(); got != StateHalfOpen {
+			t.Fatalf("State = %v, want %v", got, StateHalfOpen)
+		}
+
+		if d := c.Breaker.RetryAfter(); d != 0 {
+			t.Fatalf("RetryAfter = %v, want 0", d)
+		}
+
+		upstream.Script("1", fake.Step{Latency: 50 * time.Millisecond})
+
+		done := make(chan error)
+
+		go func() {
+			_, err := c.GetBalance(ctx, in)
+			done <- err
+		}()
+
+		requests.wait(t, 3)
+
+		if _, err := c.GetBalance(ctx, in); err != ErrCircuitOpen {
+			t.Fatalf("GetBalance during trial = %v, want %v", err, ErrCircuitOpen)
+		}
+
+		if err := <-done; err != nil {
+			t.Fatalf("trial: %v", err)
+		}
+
+		if got := c.Breaker.State(); got != StateClosed {
+			t.Fatalf("State = %v, want %v", got, StateClosed)
+		}
+	})
+
+	t.Run("failed trial opens again", func(t *testing.T) {
+		upstream, _, s := newUpstream()
+		defer s.Close()
+
+		c := newBreakerClient(s.URL)
+		open(t, c, upstream)
+		time.Sleep(cooldown)
+
+		upstream.Script("1", fake.Step{Status: 500})
+
+		if _, err := c.GetBalance(ctx, in); err == nil {
+			t.Fatal("trial succeeded, want an error")
+		}
+
+		if got := c.Breaker.State(); got != StateOpen {
+			t.Fatalf("State = %v, want %v", got, StateOpen)
+		}
+	})
+
+	t.Run("cancelled trial is aborted", func(t *testing.T) {
+		upstream, requests, s := newUpstream()
+		defer s.Close()
+
+		c := newBreakerClient(s.URL)
+		open(t, c, upstream)
+		time.Sleep(cooldown)
+
+		upstream.Script("1", fake.Step{Latency: time.Second})
+
+		trialCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+
+		go func() {
+			_, err := c.GetBalance(trialCtx, in)
+			done <- err
+		}()
+
+		requests.wait(t, 3)
+		cancel()
+
+		if err := <-done; errors.Cause(err) != context.Canceled {
+			t.Fatalf("trial = %v, want %v", err, context.Canceled)
+		}
+
+		if got := c.Breaker.State(); got != StateHalfOpen {
+			t.Fatalf("State = %v, want %v", got, StateHalfOpen)
+		}
+
+		// another trial goes through
+		if _, err := c.GetBalance(ctx, in); err != nil {
+			t.Fatalf("GetBalance: %v", err)
+		}
+
+		if got := c.Breaker.State(); got != StateClosed {
+			t.Fatalf("State = %v, want %v", got, StateClosed)
+		}
+	})
+}
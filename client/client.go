@@ -1,17 +1,40 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"math/rand"
 	"net/http"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
+// ErrCircuitOpen is returned while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
 // Client for request balance.
 type Client struct {
 	Endpoint string
 	Token    string
+
+	// HTTPClient is the client used to make requests.
+	HTTPClient *http.Client
+
+	// Timeout is the timeout of each attempt.
+	Timeout time.Duration
+
+	// MaxRetries is the number of retries after a failed attempt.
+	MaxRetries int
+
+	// MinBackoff and MaxBackoff bound the exponential backoff between
+	// attempts, which is fully jittered.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Breaker fails requests fast while the upstream is down.
+	Breaker *Breaker
 }
 
 // RequestInput is the input for request balance.
@@ -28,29 +51,136 @@ type RequestOutput struct {
 	} `json:"data"`
 }
 
+// retryableError is an error worth retrying.
+type retryableError struct {
+	error
+}
+
 // NewClient create a new client.
 func NewClient(url string) *Client {
 	return &Client{
-		Endpoint: url,
+		Endpoint:   url,
+		HTTPClient: &http.Client{},
+		Timeout:    5 * time.Second,
+		MaxRetries: 2,
+		MinBackoff: 100 * time.Millisecond,
+		MaxBackoff: 2 * time.Second,
+		Breaker:    NewBreaker(5, 30*time.Second),
 	}
 }
 
 // GetBalance get the balance for the given card.
-func (c *Client) GetBalance(in *RequestInput) (*RequestOutput, error) {
+func (c *Client) GetBalance(ctx context.Context, in *RequestInput) (*RequestOutput, error) {
 	url := fmt.Sprintf("%s/%s", c.Endpoint, in.Card)
-	res, err := http.Get(url)
+
+	for attempt := 0; ; attempt++ {
+		if c.Breaker != nil && !c.Breaker.allow() {
+			return nil, ErrCircuitOpen
+		}
+
+		out, err := c.get(ctx, url)
+
+		if err == nil {
+			if c.Breaker != nil {
+				c.Breaker.success()
+			}
+
+			return out, nil
+		}
+
+		// the caller gave up, which says nothing about the upstream
+		if ctx.Err() != nil {
+			if c.Breaker != nil {
+				c.Breaker.abort()
+			}
+
+			return nil, errors.Wrap(ctx.Err(), "requesting")
+		}
+
+		rerr, retryable := err.(retryableError)
+
+		// the upstream answered, so it is up even if the answer is wrong
+		if !retryable {
+			if c.Breaker != nil {
+				c.Breaker.success()
+			}
+
+			return nil, err
+		}
+
+		if c.Breaker != nil {
+			c.Breaker.failure()
+		}
+
+		if attempt >= c.MaxRetries {
+			return nil, rerr.error
+		}
+
+		select {
+		case <-time.After(c.backoff(attempt)):
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err(), "requesting")
+		}
+	}
+}
+
+// get makes a single attempt.
+func (c *Client) get(ctx context.Context, url string) (*RequestOutput, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
 
 	if err != nil {
-		return nil, errors.Wrap(err, "requesting")
+		return nil, errors.Wrap(err, "creating request")
+	}
+
+	hc := c.HTTPClient
+
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	res, err := hc.Do(req.WithContext(ctx))
+
+	if err != nil {
+		return nil, retryableError{errors.Wrap(err, "requesting")}
 	}
 
 	defer res.Body.Close()
 
+	if res.StatusCode >= 500 {
+		return nil, retryableError{errors.Errorf("unexpected status %d", res.StatusCode)}
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %d", res.StatusCode)
+	}
+
 	out := new(RequestOutput)
 
 	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
-		return nil, errors.Wrap(err, "unmarshaling output")
+		return nil, errors.Wrapf(ErrUpstreamMalformed, "unmarshaling output: %s", err)
 	}
 
 	return out, nil
 }
+
+// backoff returns a random delay for the given attempt, up to MinBackoff
+// doubled per attempt and capped to MaxBackoff.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.MinBackoff << uint(attempt)
+
+	if d <= 0 || (c.MaxBackoff > 0 && d > c.MaxBackoff) {
+		d = c.MaxBackoff
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(d)))
+}
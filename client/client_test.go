@@ -0,0 +1,198 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc/client/fake"
+)
+
+// counter counts the requests to a handler.
+type counter struct {
+	http.Handler
+	n int32
+}
+
+func (c *counter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&c.n, 1)
+	c.Handler.ServeHTTP(w, r)
+}
+
+func (c *counter) count() int {
+	return int(atomic.LoadInt32(&c.n))
+}
+
+// wait waits for n requests to arrive.
+func (c *counter) wait(t *testing.T, n int) {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); c.count() < n; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d requests, want %d", c.count(), n)
+		}
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// newUpstream returns a fake upstream with card 1, and a server counting its
+// requests.
+func newUpstream() (*fake.Server, *counter, *httptest.Server) {
+	upstream := fake.New()
+	upstream.SetCard("1", fake.Card{Balance: 10, Status: "Activo"})
+
+	c := &counter{Handler: upstream}
+
+	return upstream, c, httptest.NewServer(c)
+}
+
+// newClient returns a client with short backoffs.
+func newClient(url string) *Client {
+	c := NewClient(url)
+	c.MinBackoff = time.Millisecond
+	c.MaxBackoff = time.Millisecond
+
+	return c
+}
+
+func TestGetBalanceRetries(t *testing.T) {
+	ctx := context.Background()
+	in := &RequestInput{Card: "1"}
+
+	t.Run("5xx is retried", func(t *testing.T) {
+		upstream, requests, s := newUpstream()
+		defer s.Close()
+
+		upstream.Script("1", fake.Step{Status: 500}, fake.Step{Status: 503})
+
+		out, err := newClient(s.URL).GetBalance(ctx, in)
+		if err != nil {
+			t.Fatalf("GetBalance: %v", err)
+		}
+
+		if len(out.Data) != 1 || out.Data[0].Balance != 10 {
+			t.Fatalf("GetBalance = %+v", out)
+		}
+
+		if n := requests.count(); n != 3 {
+			t.Fatalf("got %d requests, want 3", n)
+		}
+	})
+
+	t.Run("5xx until retries run out", func(t *testing.T) {
+		upstream, requests, s := newUpstream()
+		defer s.Close()
+
+		upstream.Script("1", fake.Step{Status: 500}, fake.Step{Status: 500}, fake.Step{Status: 500})
+
+		if _, err := newClient(s.URL).GetBalance(ctx, in); err == nil {
+			t.Fatal("GetBalance succeeded, want an error")
+		}
+
+		if n := requests.count(); n != 3 {
+			t.Fatalf("got %d requests, want 3", n)
+		}
+	})
+
+	t.Run("network error is retried", func(t *testing.T) {
+		var requests int
+
+		c := newClient("http://upstream")
+		c.HTTPClient = &http.Client{
+			Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+				requests++
+				return nil, errors.New("connection refused")
+			}),
+		}
+
+		if _, err := c.GetBalance(ctx, in); err == nil {
+			t.Fatal("GetBalance succeeded, want an error")
+		}
+
+		if requests != 3 {
+			t.Fatalf("got %d requests, want 3", requests)
+		}
+	})
+
+	t.Run("4xx is not retried", func(t *testing.T) {
+		upstream, requests, s := newUpstream()
+		defer s.Close()
+
+		upstream.Script("1", fake.Step{Status: 404})
+
+		c := newClient(s.URL)
+
+		if _, err := c.GetBalance(ctx, in); err == nil {
+			t.Fatal("GetBalance succeeded, want an error")
+		}
+
+		if n := requests.count(); n != 1 {
+			t.Fatalf("got %d requests, want 1", n)
+		}
+
+		if got := c.Breaker.State(); got != StateClosed {
+			t.Fatalf("State = %v, want %v", got, StateClosed)
+		}
+	})
+
+	t.Run("decode error is not retried", func(t *testing.T) {
+		requests := &counter{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"code": 0, "data": [{"balance": "abc"`))
+			}),
+		}
+
+		s := httptest.NewServer(requests)
+		defer s.Close()
+
+		c := newClient(s.URL)
+
+		if _, err := c.GetBalance(ctx, in); errors.Cause(err) != ErrUpstreamMalformed {
+			t.Fatalf("GetBalance = %v, want %v", err, ErrUpstreamMalformed)
+		}
+
+		if n := requests.count(); n != 1 {
+			t.Fatalf("got %d requests, want 1", n)
+		}
+
+		if got := c.Breaker.State(); got != StateClosed {
+			t.Fatalf("State = %v, want %v", got, StateClosed)
+		}
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	c := &Client{
+		MinBackoff: 100 * time.Millisecond,
+		MaxBackoff: time.Second,
+	}
+
+	// past 63 attempts the shift overflows
+	for attempt := 0; attempt < 70; attempt++ {
+		max := c.MaxBackoff
+
+		if attempt < 4 {
+			max = c.MinBackoff << uint(attempt)
+		}
+
+		for i := 0; i < 100; i++ {
+			if d := c.backoff(attempt); d < 0 || d >= max {
+				t.Fatalf("backoff(%d) = %v, want it in [0, %v)", attempt, d, max)
+			}
+		}
+	}
+
+	if d := (&Client{}).backoff(3); d != 0 {
+		t.Fatalf("backoff without bounds = %v, want 0", d)
+	}
+}
@@ -0,0 +1,70 @@
+package fake
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Config is the JSON configuration of a Server.
+type Config struct {
+	Latency string                `json:"latency"`
+	Cards   map[string]ConfigCard `json:"cards"`
+}
+
+// ConfigCard is the configuration of a card.
+type ConfigCard struct {
+	Card
+	Script []ConfigStep `json:"script"`
+}
+
+// ConfigStep is the configuration of a scripted step.
+type ConfigStep struct {
+	Step
+	Latency string `json:"latency"`
+}
+
+// Load returns a new Server configured from r.
+func Load(r io.Reader) (*Server, error) {
+	var c Config
+
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return nil, errors.Wrap(err, "parsing config")
+	}
+
+	s := New()
+
+	latency, err := parseDuration(c.Latency)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing latency")
+	}
+
+	s.SetLatency(latency)
+
+	for number, card := range c.Cards {
+		s.SetCard(number, card.Card)
+
+		for _, cs := range card.Script {
+			step := cs.Step
+
+			if step.Latency, err = parseDuration(cs.Latency); err != nil {
+				return nil, errors.Wrapf(err, "parsing latency of card %s", number)
+			}
+
+			s.Script(number, step)
+		}
+	}
+
+	return s, nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,162 @@
+// Package fake provides a fake TUC balance upstream, usable with httptest or
+// as a standalone server.
+package fake
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// codeNotFound is the upstream code for an unknown card.
+const codeNotFound = 2
+
+// Card is a card known to the server.
+type Card struct {
+	Balance float64 `json:"balance"`
+	Status  string  `json:"status"`
+}
+
+// Step is a scripted response, consumed by the next request for a card.
+type Step struct {
+	// Latency delays the response.
+	Latency time.Duration `json:"-"`
+
+	// Status responds with the given HTTP status instead of the card.
+	Status int `json:"status,omitempty"`
+
+	// Balance changes the balance of the card before responding.
+	Balance *float64 `json:"balance,omitempty"`
+}
+
+// Server is a fake upstream serving GET /{card}.
+type Server struct {
+	mu      sync.Mutex
+	cards   map[string]Card
+	scripts map[string][]Step
+	latency time.Duration
+}
+
+// New returns a new instance of Server.
+func New() *Server {
+	return &Server{
+		cards:   make(map[string]Card),
+		scripts: make(map[string][]Step),
+	}
+}
+
+// SetCard adds or replaces a card.
+func (s *Server) SetCard(number string, card Card) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cards[number] = card
+}
+
+// SetBalance changes the balance of a card.
+func (s *Server) SetBalance(number string, balance float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.cards[number]
+	c.Balance = balance
+	s.cards[number] = c
+}
+
+// RemoveCard removes a card, which is then reported as unknown.
+func (s *Server) RemoveCard(number string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.cards, number)
+}
+
+// SetLatency delays every response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency = d
+}
+
+// Script queues steps for the next requests for a card.
+func (s *Server) Script(number string, steps ...Step) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scripts[number] = append(s.scripts[number], steps...)
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	number := path.Base(r.URL.Path)
+	step, card, ok, latency := s.next(number)
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if step.Status != 0 {
+		w.WriteHeader(step.Status)
+		return
+	}
+
+	type data struct {
+		Balance string `json:"balance"`
+		Status  string `json:"status"`
+	}
+
+	out := struct {
+		Code int    `json:"code"`
+		Data []data `json:"data"`
+	}{
+		Data: []data{},
+	}
+
+	if ok {
+		out.Data = append(out.Data, data{
+			Balance: strconv.FormatFloat(card.Balance, 'f', 2, 64),
+			Status:  card.Status,
+		})
+	} else {
+		out.Code = codeNotFound
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// next consumes the next step for a card and returns it with the resulting
+// card and the latency to apply.
+func (s *Server) next(number string) (Step, Card, bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var step Step
+
+	if steps := s.scripts[number]; len(steps) > 0 {
+		step = steps[0]
+		s.scripts[number] = steps[1:]
+	}
+
+	card, ok := s.cards[number]
+
+	if ok && step.Balance != nil {
+		card.Balance = *step.Balance
+		s.cards[number] = card
+	}
+
+	return step, card, ok, s.latency + step.Latency
+}
@@ -0,0 +1,172 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Exchange is a recorded request and its response.
+type Exchange struct {
+	Body   string      `json:"body"`
+	Header http.Header `json:"header,omitempty"`
+	Method string      `json:"method"`
+	Status int         `json:"status"`
+	Time   time.Time   `json:"time"`
+	URL    string      `json:"url"`
+}
+
+// RecordingTransport is an http.RoundTripper which appends every exchange as
+// a JSON line to a writer.
+type RecordingTransport struct {
+	Transport http.RoundTripper
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewRecordingTransport returns a new instance of RecordingTransport writing
+// to w. Requests are made with rt, or http.DefaultTransport when nil.
+func NewRecordingTransport(w io.Writer, rt http.RoundTripper) *RecordingTransport {
+	return &RecordingTransport{
+		Transport: rt,
+		enc:       json.NewEncoder(w),
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt := t.Transport
+
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	res, err := rt.RoundTrip(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "reading body")
+	}
+
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err = t.enc.Encode(Exchange{
+		Body:   string(body),
+		Header: res.Header,
+		Method: req.Method,
+		Status: res.StatusCode,
+		Time:   time.Now().UTC(),
+		URL:    req.URL.String(),
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "recording exchange")
+	}
+
+	return res, nil
+}
+
+// ReplayTransport is an http.RoundTripper which serves recorded exchanges.
+//
+// Exchanges are matched by method, path and query, so a recording can be
+// replayed against any endpoint. Exchanges for the same request are served in
+// the order they were recorded, and the last one is repeated once they run
+// out.
+type ReplayTransport struct {
+	mu        sync.Mutex
+	exchanges map[string][]Exchange
+}
+
+// NewReplayTransport returns a new instance of ReplayTransport serving the
+// exchanges read as JSON lines from r.
+func NewReplayTransport(r io.Reader) (*ReplayTransport, error) {
+	t := &ReplayTransport{
+		exchanges: make(map[string][]Exchange),
+	}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+
+	for s.Scan() {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+
+		var e Exchange
+
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return nil, errors.Wrap(err, "parsing exchange")
+		}
+
+		u, err := url.Parse(e.URL)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing url")
+		}
+
+		key := e.Method + " " + u.RequestURI()
+		t.exchanges[key] = append(t.exchanges[key], e)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading exchanges")
+	}
+
+	return t, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := req.Method + " " + req.URL.RequestURI()
+	exchanges := t.exchanges[key]
+
+	if len(exchanges) == 0 {
+		return nil, errors.Errorf("no recorded exchange for %s", key)
+	}
+
+	e := exchanges[0]
+
+	if len(exchanges) > 1 {
+		t.exchanges[key] = exchanges[1:]
+	}
+
+	header := e.Header
+
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	return &http.Response{
+		Body:          ioutil.NopCloser(bytes.NewBufferString(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Header:        header,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Request:       req,
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+	}, nil
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestRecordReplay(t *testing.T) {
+	ctx := context.Background()
+
+	upstream, _, s := newUpstream()
+	defer s.Close()
+
+	var recording bytes.Buffer
+
+	c := newClient(s.URL)
+	c.HTTPClient.Transport = NewRecordingTransport(&recording, nil)
+
+	// what the upstream answers, in order
+	want := []float64{10, 20}
+
+	for _, balance := range want {
+		upstream.SetBalance("1", balance)
+
+		b, err := c.Balance(ctx, "1")
+		if err != nil {
+			t.Fatalf("Balance: %v", err)
+		}
+
+		if b.Balance != balance {
+			t.Fatalf("Balance = %v, want %v", b.Balance, balance)
+		}
+	}
+
+	if _, err := c.Balance(ctx, "2"); err != ErrCardNotFound {
+		t.Fatalf("Balance = %v, want %v", err, ErrCardNotFound)
+	}
+
+	rt, err := NewReplayTransport(&recording)
+	if err != nil {
+		t.Fatalf("NewReplayTransport: %v", err)
+	}
+
+	// replayed against another endpoint, repeating the last exchange
+	c = newClient("http://replay")
+	c.HTTPClient.Transport = rt
+
+	for _, balance := range append(want, 20) {
+		b, err := c.Balance(ctx, "1")
+		if err != nil {
+			t.Fatalf("Balance: %v", err)
+		}
+
+		if b.Balance != balance || b.Status != CardStatusActive {
+			t.Fatalf("Balance = %+v, want %v", b, balance)
+		}
+	}
+
+	if _, err := c.Balance(ctx, "2"); err != ErrCardNotFound {
+		t.Fatalf("Balance = %v, want %v", err, ErrCardNotFound)
+	}
+
+	c.MaxRetries = 0
+
+	if _, err := c.Balance(ctx, "3"); err == nil {
+		t.Fatal("Balance of an unrecorded card succeeded, want an error")
+	}
+}
+
+func TestReplayMalformed(t *testing.T) {
+	f, err := os.Open("testdata/malformed.jsonl")
+	if err != nil {
+		t.Fatalf("opening fixture: %v", err)
+	}
+	defer f.Close()
+
+	rt, err := NewReplayTransport(f)
+	if err != nil {
+		t.Fatalf("NewReplayTransport: %v", err)
+	}
+
+	c := newClient("http://upstream")
+	c.HTTPClient.Transport = rt
+
+	b, err := c.Balance(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("Balance: %v", err)
+	}
+
+	if b.Balance != 10.5 {
+		t.Fatalf("Balance = %v, want 10.5", b.Balance)
+	}
+
+	// the balance is not a number
+	if _, err := c.Balance(context.Background(), "1"); errors.Cause(err) != ErrUpstreamMalformed {
+		t.Fatalf("Balance = %v, want %v", err, ErrUpstreamMalformed)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/apex/log"
+	texthandler "github.com/apex/log/handlers/text"
+	"github.com/tj/go/env"
+
+	"github.com/nerdify/tuc/client/fake"
+)
+
+func init() {
+	log.SetHandler(texthandler.Default)
+}
+
+func main() {
+	addr := ":" + env.GetDefault("FAKE_UPSTREAM_PORT", "5001")
+	s := fake.New()
+
+	if path := os.Getenv("FAKE_UPSTREAM_CONFIG"); path != "" {
+		f, err := os.Open(path)
+
+		if err != nil {
+			log.WithError(err).Fatal("opening config")
+		}
+
+		s, err = fake.Load(f)
+		f.Close()
+
+		if err != nil {
+			log.WithError(err).Fatal("loading config")
+		}
+	}
+
+	log.WithField("addr", addr).Info("listening")
+
+	if err := http.ListenAndServe(addr, s); err != nil {
+		log.WithError(err).Fatal("binding")
+	}
+}
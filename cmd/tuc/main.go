@@ -1,16 +1,29 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"os"
+	"strings"
 
 	"github.com/apex/log"
 	jsonhandler "github.com/apex/log/handlers/json"
 	texthandler "github.com/apex/log/handlers/text"
 	"github.com/gorilla/mux"
-	"github.com/nerdify/tuc/dynamodb"
+	uuid "github.com/satori/go.uuid"
 	"github.com/tj/go/env"
 
+	"github.com/nerdify/tuc"
 	"github.com/nerdify/tuc/api"
+	"github.com/nerdify/tuc/client"
+	"github.com/nerdify/tuc/dynamodb"
+	"github.com/nerdify/tuc/events"
+	"github.com/nerdify/tuc/facebook"
+	"github.com/nerdify/tuc/fare"
+	"github.com/nerdify/tuc/google"
+	"github.com/nerdify/tuc/keyset"
+	"github.com/nerdify/tuc/memory"
+	"github.com/nerdify/tuc/refresh"
 )
 
 func init() {
@@ -22,6 +35,16 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "refresh" {
+		runRefresh()
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate-users" {
+		runMigrateUsers()
+		return
+	}
+
 	addr := ":" + env.Get("PORT")
 
 	http.Handle("/", buildRouter())
@@ -31,15 +54,237 @@ func main() {
 	}
 }
 
+// runRefresh refreshes the balance of every card once.
+func runRefresh() {
+	s := buildServices()
+
+	r := &refresh.Refresher{
+		CardService: s.cards,
+		Client:      buildClient(),
+		Recorder:    buildRecorder(s, buildFares()),
+	}
+
+	stats, err := r.Run(context.Background())
+
+	if err != nil {
+		log.WithError(err).Fatal("refreshing")
+	}
+
+	log.WithFields(log.Fields{
+		"cards":   stats.Cards,
+		"updated": stats.Updated,
+		"skipped": stats.Skipped,
+		"failed":  stats.Failed,
+	}).Info("refreshed")
+}
+
+// runMigrateUsers moves the dynamodb users keyed by email to generated ids.
+func runMigrateUsers() {
+	stats, err := dynamodb.MigrateUsers(context.Background(), buildDynamoDB(), func() string {
+		return uuid.NewV4().String()
+	})
+
+	if err != nil {
+		log.WithError(err).Fatal("migrating users")
+	}
+
+	log.WithFields(log.Fields{
+		"card_members":   stats.CardMembers,
+		"cards":          stats.Cards,
+		"identities":     stats.Identities,
+		"login_requests": stats.LoginRequests,
+		"refresh_tokens": stats.RefreshTokens,
+		"users":          stats.Users,
+	}).Info("migrated users")
+}
+
 func buildRouter() *mux.Router {
-	app := mux.NewRouter().PathPrefix("/api").Subrouter()
+	s := buildServices()
+	auth := api.NewAuthenticator(buildKeyset(), s.revocations)
+
+	root := mux.NewRouter()
+	root.HandleFunc("/.well-known/jwks.json", auth.HandleJWKS).Methods(http.MethodGet)
+
+	app := root.PathPrefix("/api").Subrouter()
+
+	ah := api.NewAuthHandler(app, auth)
+	ah.Providers = buildProviders(
+		buildFacebook(),
+		google.NewVerifier(strings.Split(os.Getenv("GOOGLE_CLIENT_ID"), ",")...),
+	)
+	ah.UserService = s.users
+	ah.LoginRequestService = s.loginRequests
+	ah.RefreshTokenService = s.refreshTokens
+	ah.CardInviteService = s.cardInvites
+	ah.CardService = s.cards
+
+	ch := api.NewCardHandler(app, auth)
+	ch.BalanceHistoryService = s.balanceHistory
+	ch.CardEventService = s.cardEvents
+	ch.CardInviteService = s.cardInvites
+	ch.CardService = s.cards
+	ch.Client = buildClient()
+	ch.Fares = buildFares()
+	ch.Recorder = buildRecorder(s, ch.Fares)
+	ch.UserService = s.users
+
+	uh := api.NewUserHandler(app, auth)
+	uh.EmailChangeService = s.emailChanges
+	uh.RefreshTokenService = s.refreshTokens
+	uh.UserService = s.users
+
+	return root
+}
+
+// services are the storage services shared by the api and the refresher.
+type services struct {
+	balanceHistory tuc.BalanceHistoryService
+	cardEvents     tuc.CardEventService
+	cardInvites    tuc.CardInviteService
+	cards          tuc.CardService
+	emailChanges   tuc.EmailChangeService
+	loginRequests  tuc.LoginRequestService
+	refreshTokens  tuc.RefreshTokenService
+	revocations    tuc.RevocationService
+	users          tuc.UserService
+}
+
+func buildServices() *services {
+	switch storage := env.GetDefault("STORAGE", "dynamodb"); storage {
+	case "memory":
+		return &services{
+			balanceHistory: &memory.BalanceHistoryService{},
+			cardEvents:     &memory.CardEventService{},
+			cardInvites:    &memory.CardInviteService{},
+			cards:          &memory.CardService{},
+			emailChanges:   &memory.EmailChangeService{},
+			loginRequests:  &memory.LoginRequestService{},
+			refreshTokens:  &memory.RefreshTokenService{},
+			revocations:    &memory.RevocationService{},
+			users:          &memory.UserService{},
+		}
+	case "dynamodb":
+		db := buildDynamoDB()
+
+		return &services{
+			balanceHistory: dynamodb.NewBalanceHistoryService(db),
+			cardEvents:     dynamodb.NewCardEventService(db),
+			cardInvites:    dynamodb.NewCardInviteService(db),
+			cards:          dynamodb.NewCardService(db),
+			emailChanges:   dynamodb.NewEmailChangeService(db),
+			loginRequests:  dynamodb.NewLoginRequestService(db),
+			refreshTokens:  dynamodb.NewRefreshTokenService(db),
+			revocations:    dynamodb.NewRevocationService(db),
+			users:          dynamodb.NewUserService(db),
+		}
+	default:
+		log.WithField("storage", storage).Fatal("unknown storage")
+		return nil
+	}
+}
+
+// buildKeyset returns the keys of JWT_KEYS, see keyset.Parse, or else the
+// HS256 key JWT_KEY tokens were signed with before keys had ids.
+func buildKeyset() *keyset.Keyset {
+	if keys := os.Getenv("JWT_KEYS"); keys != "" {
+		s, err := keyset.Parse([]byte(keys))
+
+		if err != nil {
+			log.WithError(err).Fatal("parsing jwt keys")
+		}
+
+		return s
+	}
+
+	return &keyset.Keyset{
+		Keys: []*keyset.Key{
+			keyset.NewHMAC("", []byte(env.Get("JWT_KEY"))),
+		},
+	}
+}
+
+func buildDynamoDB() *dynamodb.Client {
+	db, err := dynamodb.NewClient(dynamodb.Config{
+		Endpoint:    os.Getenv("DYNAMODB_ENDPOINT"),
+		TablePrefix: os.Getenv("DYNAMODB_TABLE_PREFIX"),
+	})
+
+	if err != nil {
+		log.WithError(err).Fatal("creating dynamodb client")
+	}
+
+	return db
+}
 
-	uh := api.NewAuthHandler(app)
-	uh.UserService = &dynamodb.UserService{}
-	uh.LoginRequestService = &dynamodb.LoginRequestService{}
+func buildRecorder(s *services, fares *fare.Table) *events.Recorder {
+	return &events.Recorder{
+		BalanceHistoryService: s.balanceHistory,
+		CardEventService:      s.cardEvents,
+		CardService:           s.cards,
+		Detector: &events.Detector{
+			Fares: fares,
+		},
+	}
+}
+
+func buildFacebook() *facebook.Provider {
+	p := facebook.NewProvider(os.Getenv("FACEBOOK_APP_ID"), os.Getenv("FACEBOOK_APP_SECRET"))
+
+	if url := os.Getenv("FACEBOOK_GRAPH_URL"); url != "" {
+		p.GraphURL = url
+	}
 
-	ch := api.NewCardHandler(app)
-	ch.CardService = &dynamodb.CardService{}
+	return p
+}
+
+func buildProviders(providers ...tuc.IdentityProvider) map[string]tuc.IdentityProvider {
+	m := make(map[string]tuc.IdentityProvider)
+
+	for _, p := range providers {
+		m[p.Name()] = p
+	}
+
+	return m
+}
+
+func buildFares() *fare.Table {
+	t, err := fare.LoadFile(os.Getenv("FARES_CONFIG"))
+
+	if err != nil {
+		log.WithError(err).Fatal("loading fares config")
+	}
+
+	return t
+}
+
+func buildClient() *client.Client {
+	c := client.NewClient(env.Get("ENDPOINT"))
+
+	if path := os.Getenv("UPSTREAM_REPLAY"); path != "" {
+		f, err := os.Open(path)
+
+		if err != nil {
+			log.WithError(err).Fatal("opening replay file")
+		}
+
+		defer f.Close()
+
+		rt, err := client.NewReplayTransport(f)
+
+		if err != nil {
+			log.WithError(err).Fatal("loading replay file")
+		}
+
+		c.HTTPClient.Transport = rt
+	} else if path := os.Getenv("UPSTREAM_RECORD"); path != "" {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+		if err != nil {
+			log.WithError(err).Fatal("opening record file")
+		}
+
+		c.HTTPClient.Transport = client.NewRecordingTransport(f, nil)
+	}
 
-	return app
+	return c
 }
@@ -0,0 +1,94 @@
+package dynamodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc"
+)
+
+// snapshotItem is the item of a tuc.BalanceSnapshot, keyed by card and
+// timestamp in nanoseconds.
+type snapshotItem struct {
+	Balance   float64 `dynamodbav:"balance"`
+	CardID    string  `dynamodbav:"card_id"`
+	Timestamp int64   `dynamodbav:"ts"`
+}
+
+// BalanceHistoryService represents an dynamodb implementation of tuc.BalanceHistoryService.
+type BalanceHistoryService struct {
+	client *Client
+}
+
+var _ tuc.BalanceHistoryService = &BalanceHistoryService{}
+
+// NewBalanceHistoryService returns a new instance of BalanceHistoryService.
+func NewBalanceHistoryService(c *Client) *BalanceHistoryService {
+	return &BalanceHistoryService{
+		client: c,
+	}
+}
+
+// Append a snapshot.
+func (s *BalanceHistoryService) Append(ctx context.Context, snapshot *tuc.BalanceSnapshot) error {
+	item, _ := dynamodbattribute.MarshalMap(snapshotItem{
+		Balance:   snapshot.Balance,
+		CardID:    snapshot.CardID,
+		Timestamp: snapshot.Time.UnixNano(),
+	})
+	input := &dynamodb.PutItemInput{
+		Item:      item,
+		TableName: aws.String(s.client.tables.BalanceHistory),
+	}
+
+	req := s.client.svc.PutItemRequest(input)
+	req.SetContext(ctx)
+	_, err := req.Send()
+
+	return err
+}
+
+// List snapshots of a card.
+func (s *BalanceHistoryService) List(ctx context.Context, cardID string, from, to time.Time, limit int, cursor string) ([]tuc.BalanceSnapshot, string, error) {
+	input, err := timeRangeQuery(s.client.tables.BalanceHistory, cardID, from, to, limit, cursor)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	req := s.client.svc.QueryRequest(input)
+	req.SetContext(ctx)
+	res, err := req.Send()
+
+	if err != nil {
+		return nil, "", errors.Wrap(err, "getting items")
+	}
+
+	items := []snapshotItem{}
+
+	if err := dynamodbattribute.UnmarshalListOfMaps(res.Items, &items); err != nil {
+		return nil, "", errors.Wrap(err, "unmarshaling items")
+	}
+
+	snapshots := make([]tuc.BalanceSnapshot, len(items))
+
+	for i, item := range items {
+		snapshots[i] = tuc.BalanceSnapshot{
+			Balance: item.Balance,
+			CardID:  item.CardID,
+			Time:    time.Unix(0, item.Timestamp).UTC(),
+		}
+	}
+
+	return snapshots, nextCursor(res), nil
+}
+
+// Delete snapshots of a card.
+func (s *BalanceHistoryService) Delete(ctx context.Context, cardID string) error {
+	return deleteTimeRange(ctx, s.client, s.client.tables.BalanceHistory, cardID)
+}
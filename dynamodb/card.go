@@ -1,7 +1,11 @@
 package dynamodb
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"strconv"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
@@ -11,15 +15,22 @@ import (
 	"github.com/nerdify/tuc"
 )
 
-var cardsTable = "tuc_cards"
-
 // CardService represents an dynamodb implementation of tuc.CardService.
-type CardService struct{}
+type CardService struct {
+	client *Client
+}
 
 var _ tuc.CardService = &CardService{}
 
+// NewCardService returns a new instance of CardService.
+func NewCardService(c *Client) *CardService {
+	return &CardService{
+		client: c,
+	}
+}
+
 // List all Cards.
-func (s *CardService) List(userID string) ([]tuc.Card, error) {
+func (s *CardService) List(ctx context.Context, userID string) ([]tuc.Card, error) {
 	input := &dynamodb.QueryInput{
 		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
 			":id": {
@@ -27,10 +38,11 @@ func (s *CardService) List(userID string) ([]tuc.Card, error) {
 			},
 		},
 		KeyConditionExpression: aws.String("u_id = :id"),
-		TableName:              &cardsTable,
+		TableName:              aws.String(s.client.tables.Cards),
 	}
 
-	req := svc.QueryRequest(input)
+	req := s.client.svc.QueryRequest(input)
+	req.SetContext(ctx)
 	res, err := req.Send()
 
 	if err != nil {
@@ -43,12 +55,100 @@ func (s *CardService) List(userID string) ([]tuc.Card, error) {
 		return nil, errors.Wrap(err, "unmarshaling items")
 	}
 
+	for i := range cards {
+		cards[i].Permission = tuc.CardPermissionOwner
+	}
+
+	shared, err := s.shared(ctx, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(cards, shared...), nil
+}
+
+// shared returns the cards shared with the user.
+func (s *CardService) shared(ctx context.Context, userID string) ([]tuc.Card, error) {
+	input := &dynamodb.QueryInput{
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":id": {
+				S: &userID,
+			},
+		},
+		IndexName:              aws.String(cardMembersUserIndex),
+		KeyConditionExpression: aws.String("u_id = :id"),
+		TableName:              aws.String(s.client.tables.CardMembers),
+	}
+
+	req := s.client.svc.QueryRequest(input)
+	req.SetContext(ctx)
+	res, err := req.Send()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "getting members")
+	}
+
+	var members []tuc.CardMember
+
+	if err := dynamodbattribute.UnmarshalListOfMaps(res.Items, &members); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling members")
+	}
+
+	cards := []tuc.Card{}
+
+	for _, m := range members {
+		c, err := s.get(ctx, m.OwnerID, m.CardID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// the card may be gone while its members are deleted
+		if c == nil {
+			continue
+		}
+
+		c.Permission = m.Permission
+		cards = append(cards, *c)
+	}
+
 	return cards, nil
 }
 
 // Get individual card.
-func (s *CardService) Get(userID, cardID string) (*tuc.Card, error) {
+func (s *CardService) Get(ctx context.Context, userID, cardID string) (*tuc.Card, error) {
+	c, err := s.get(ctx, userID, cardID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if c != nil {
+		c.Permission = tuc.CardPermissionOwner
+		return c, nil
+	}
+
+	m, err := s.member(ctx, cardID, userID)
+
+	if err != nil || m == nil {
+		return nil, err
+	}
+
+	if c, err = s.get(ctx, m.OwnerID, cardID); err != nil || c == nil {
+		return nil, err
+	}
+
+	c.Permission = m.Permission
+
+	return c, nil
+}
+
+// get returns the card of its owner, read consistently so Update tells a
+// deleted card from an updated one.
+func (s *CardService) get(ctx context.Context, userID, cardID string) (*tuc.Card, error) {
 	input := &dynamodb.GetItemInput{
+		ConsistentRead: aws.Bool(true),
 		Key: map[string]dynamodb.AttributeValue{
 			"id": {
 				S: &cardID,
@@ -57,10 +157,11 @@ func (s *CardService) Get(userID, cardID string) (*tuc.Card, error) {
 				S: &userID,
 			},
 		},
-		TableName: &cardsTable,
+		TableName: aws.String(s.client.tables.Cards),
 	}
 
-	req := svc.GetItemRequest(input)
+	req := s.client.svc.GetItemRequest(input)
+	req.SetContext(ctx)
 	res, err := req.Send()
 
 	if err != nil {
@@ -81,26 +182,83 @@ func (s *CardService) Get(userID, cardID string) (*tuc.Card, error) {
 }
 
 // Create a new card.
-func (s *CardService) Create(card *tuc.Card) error {
+//
+// The condition on the item only guards its id, so the number is checked
+// beforehand as well. Callers derive the id from the user and the number to
+// close the gap between both.
+func (s *CardService) Create(ctx context.Context, card *tuc.Card) error {
+	exists, err := s.hasNumber(ctx, card.UserID, card.Number)
+
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return tuc.ErrCardExists
+	}
+
 	item, _ := dynamodbattribute.MarshalMap(card)
 	input := &dynamodb.PutItemInput{
-		Item:      item,
-		TableName: &cardsTable,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+		Item:                item,
+		TableName:           aws.String(s.client.tables.Cards),
 	}
 
-	req := svc.PutItemRequest(input)
-	_, err := req.Send()
+	req := s.client.svc.PutItemRequest(input)
+	req.SetContext(ctx)
+	_, err = req.Send()
+
+	if conditionFailed(err) {
+		return tuc.ErrCardExists
+	}
 
 	return err
 }
 
+// hasNumber reports whether the user has a card with the given number.
+func (s *CardService) hasNumber(ctx context.Context, userID, number string) (bool, error) {
+	// number is a reserved word
+	input := &dynamodb.QueryInput{
+		ConsistentRead: aws.Bool(true),
+		ExpressionAttributeNames: map[string]string{
+			"#n": "number",
+		},
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":id": {
+				S: &userID,
+			},
+			":n": {
+				S: &number,
+			},
+		},
+		FilterExpression:       aws.String("#n = :n"),
+		KeyConditionExpression: aws.String("u_id = :id"),
+		ProjectionExpression:   aws.String("id"),
+		TableName:              aws.String(s.client.tables.Cards),
+	}
+
+	req := s.client.svc.QueryRequest(input)
+	req.SetContext(ctx)
+	res, err := req.Send()
+
+	if err != nil {
+		return false, errors.Wrap(err, "querying items")
+	}
+
+	return len(res.Items) > 0, nil
+}
+
 // Update a card.
-func (s *CardService) Update(userID, cardID string, balance float64) (*tuc.Card, error) {
+func (s *CardService) Update(ctx context.Context, userID, cardID string, prev, balance float64) (*tuc.Card, error) {
 	input := &dynamodb.UpdateItemInput{
+		ConditionExpression: aws.String("attribute_exists(id) and balance = :p"),
 		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
 			":b": {
 				N: aws.String(strconv.FormatFloat(balance, 'f', -1, 64)),
 			},
+			":p": {
+				N: aws.String(strconv.FormatFloat(prev, 'f', -1, 64)),
+			},
 		},
 		Key: map[string]dynamodb.AttributeValue{
 			"id": {
@@ -111,13 +269,106 @@ func (s *CardService) Update(userID, cardID string, balance float64) (*tuc.Card,
 			},
 		},
 		ReturnValues:     dynamodb.ReturnValueAllNew,
-		TableName:        &cardsTable,
+		TableName:        aws.String(s.client.tables.Cards),
 		UpdateExpression: aws.String("SET balance = :b"),
 	}
 
-	req := svc.UpdateItemRequest(input)
+	req := s.client.svc.UpdateItemRequest(input)
+	req.SetContext(ctx)
 	res, err := req.Send()
 
+	// deleted or updated since it was read
+	if conditionFailed(err) {
+		c, err := s.get(ctx, userID, cardID)
+
+		if err != nil || c == nil {
+			return nil, err
+		}
+
+		return nil, tuc.ErrBalanceChanged
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "updating item")
+	}
+
+	var c tuc.Card
+
+	if err := dynamodbattribute.UnmarshalMap(res.Attributes, &c); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling item")
+	}
+
+	return &c, nil
+}
+
+// Patch a card.
+func (s *CardService) Patch(ctx context.Context, userID, cardID string, patch *tuc.CardPatch) (*tuc.Card, error) {
+	var sets []string
+	names := map[string]string{}
+	values := map[string]dynamodb.AttributeValue{}
+
+	if patch.LowBalanceThreshold != nil {
+		sets = append(sets, "low_balance_threshold = :lbt")
+		values[":lbt"] = dynamodb.AttributeValue{
+			N: aws.String(strconv.FormatFloat(*patch.LowBalanceThreshold, 'f', -1, 64)),
+		}
+	}
+
+	// name is a reserved word
+	if patch.Name != nil {
+		sets = append(sets, "#n = :n")
+		names["#n"] = "name"
+		values[":n"] = dynamodb.AttributeValue{
+			S: patch.Name,
+		}
+	}
+
+	if patch.NotifyEmail != nil {
+		sets = append(sets, "notify_email = :ne")
+		values[":ne"] = dynamodb.AttributeValue{
+			BOOL: patch.NotifyEmail,
+		}
+	}
+
+	if patch.NotifyPush != nil {
+		sets = append(sets, "notify_push = :np")
+		values[":np"] = dynamodb.AttributeValue{
+			BOOL: patch.NotifyPush,
+		}
+	}
+
+	if len(sets) == 0 {
+		return s.Get(ctx, userID, cardID)
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		ConditionExpression:       aws.String("attribute_exists(id)"),
+		ExpressionAttributeValues: values,
+		Key: map[string]dynamodb.AttributeValue{
+			"id": {
+				S: &cardID,
+			},
+			"u_id": {
+				S: &userID,
+			},
+		},
+		ReturnValues:     dynamodb.ReturnValueAllNew,
+		TableName:        aws.String(s.client.tables.Cards),
+		UpdateExpression: aws.String("SET " + strings.Join(sets, ", ")),
+	}
+
+	if len(names) > 0 {
+		input.ExpressionAttributeNames = names
+	}
+
+	req := s.client.svc.UpdateItemRequest(input)
+	req.SetContext(ctx)
+	res, err := req.Send()
+
+	if conditionFailed(err) {
+		return nil, nil
+	}
+
 	if err != nil {
 		return nil, errors.Wrap(err, "updating item")
 	}
@@ -132,7 +383,7 @@ func (s *CardService) Update(userID, cardID string, balance float64) (*tuc.Card,
 }
 
 // Delete card.
-func (s *CardService) Delete(userID, cardID string) error {
+func (s *CardService) Delete(ctx context.Context, userID, cardID string) error {
 	input := &dynamodb.DeleteItemInput{
 		Key: map[string]dynamodb.AttributeValue{
 			"u_id": {
@@ -142,11 +393,101 @@ func (s *CardService) Delete(userID, cardID string) error {
 				S: &cardID,
 			},
 		},
-		TableName: &cardsTable,
+		ReturnValues: dynamodb.ReturnValueAllOld,
+		TableName:    aws.String(s.client.tables.Cards),
 	}
 
-	req := svc.DeleteItemRequest(input)
-	_, err := req.Send()
+	req := s.client.svc.DeleteItemRequest(input)
+	req.SetContext(ctx)
+	res, err := req.Send()
 
-	return err
+	if err != nil {
+		return errors.Wrap(err, "deleting item")
+	}
+
+	// only the owner deletes the members of a card
+	if len(res.Attributes) == 0 {
+		return nil
+	}
+
+	members, err := s.Members(ctx, cardID)
+
+	if err != nil {
+		return err
+	}
+
+	for _, m := range members {
+		if err := s.Unshare(ctx, cardID, m.UserID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cardKey is the key of a card, used as the Scan cursor.
+type cardKey struct {
+	ID     string `json:"id"`
+	UserID string `json:"u_id"`
+}
+
+// Scan all cards.
+func (s *CardService) Scan(ctx context.Context, limit int, cursor string) ([]tuc.Card, string, error) {
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(s.client.tables.Cards),
+	}
+
+	if limit > 0 {
+		input.Limit = aws.Int64(int64(limit))
+	}
+
+	if cursor != "" {
+		b, err := base64.RawURLEncoding.DecodeString(cursor)
+
+		if err != nil {
+			return nil, "", tuc.ErrInvalidCursor
+		}
+
+		var k cardKey
+
+		if err := json.Unmarshal(b, &k); err != nil || k.ID == "" || k.UserID == "" {
+			return nil, "", tuc.ErrInvalidCursor
+		}
+
+		input.ExclusiveStartKey = map[string]dynamodb.AttributeValue{
+			"id": {
+				S: &k.ID,
+			},
+			"u_id": {
+				S: &k.UserID,
+			},
+		}
+	}
+
+	req := s.client.svc.ScanRequest(input)
+	req.SetContext(ctx)
+	res, err := req.Send()
+
+	if err != nil {
+		return nil, "", errors.Wrap(err, "scanning items")
+	}
+
+	cards := []tuc.Card{}
+
+	if err := dynamodbattribute.UnmarshalListOfMaps(res.Items, &cards); err != nil {
+		return nil, "", errors.Wrap(err, "unmarshaling items")
+	}
+
+	if len(res.LastEvaluatedKey) == 0 {
+		return cards, "", nil
+	}
+
+	k := cardKey{
+		ID:     aws.StringValue(res.LastEvaluatedKey["id"].S),
+		UserID: aws.StringValue(res.LastEvaluatedKey["u_id"].S),
+	}
+
+	b, _ := json.Marshal(k)
+
+	return cards, base64.RawURLEncoding.EncodeToString(b), nil
 }
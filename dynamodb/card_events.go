@@ -0,0 +1,103 @@
+package dynamodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc"
+)
+
+// eventItem is the item of a tuc.CardEvent, keyed by card and timestamp in
+// nanoseconds.
+type eventItem struct {
+	Amount    float64           `dynamodbav:"amount"`
+	Balance   float64           `dynamodbav:"balance"`
+	CardID    string            `dynamodbav:"card_id"`
+	Timestamp int64             `dynamodbav:"ts"`
+	Trips     int               `dynamodbav:"trips,omitempty"`
+	Type      tuc.CardEventType `dynamodbav:"type"`
+}
+
+// CardEventService represents an dynamodb implementation of tuc.CardEventService.
+type CardEventService struct {
+	client *Client
+}
+
+var _ tuc.CardEventService = &CardEventService{}
+
+// NewCardEventService returns a new instance of CardEventService.
+func NewCardEventService(c *Client) *CardEventService {
+	return &CardEventService{
+		client: c,
+	}
+}
+
+// Create a new event.
+func (s *CardEventService) Create(ctx context.Context, event *tuc.CardEvent) error {
+	item, _ := dynamodbattribute.MarshalMap(eventItem{
+		Amount:    event.Amount,
+		Balance:   event.Balance,
+		CardID:    event.CardID,
+		Timestamp: event.Time.UnixNano(),
+		Trips:     event.Trips,
+		Type:      event.Type,
+	})
+	input := &dynamodb.PutItemInput{
+		Item:      item,
+		TableName: aws.String(s.client.tables.CardEvents),
+	}
+
+	req := s.client.svc.PutItemRequest(input)
+	req.SetContext(ctx)
+	_, err := req.Send()
+
+	return err
+}
+
+// List events of a card.
+func (s *CardEventService) List(ctx context.Context, cardID string, from, to time.Time, limit int, cursor string) ([]tuc.CardEvent, string, error) {
+	input, err := timeRangeQuery(s.client.tables.CardEvents, cardID, from, to, limit, cursor)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	req := s.client.svc.QueryRequest(input)
+	req.SetContext(ctx)
+	res, err := req.Send()
+
+	if err != nil {
+		return nil, "", errors.Wrap(err, "getting items")
+	}
+
+	items := []eventItem{}
+
+	if err := dynamodbattribute.UnmarshalListOfMaps(res.Items, &items); err != nil {
+		return nil, "", errors.Wrap(err, "unmarshaling items")
+	}
+
+	events := make([]tuc.CardEvent, len(items))
+
+	for i, item := range items {
+		events[i] = tuc.CardEvent{
+			Amount:  item.Amount,
+			Balance: item.Balance,
+			CardID:  item.CardID,
+			Time:    time.Unix(0, item.Timestamp).UTC(),
+			Trips:   item.Trips,
+			Type:    item.Type,
+		}
+	}
+
+	return events, nextCursor(res), nil
+}
+
+// Delete events of a card.
+func (s *CardEventService) Delete(ctx context.Context, cardID string) error {
+	return deleteTimeRange(ctx, s.client, s.client.tables.CardEvents, cardID)
+}
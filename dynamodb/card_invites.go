@@ -0,0 +1,112 @@
+package dynamodb
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc"
+)
+
+// cardInvitesEmailIndex is the global secondary index of the card invites
+// table keyed by email and card_id.
+const cardInvitesEmailIndex = "email-index"
+
+// CardInviteService represents an dynamodb implementation of
+// tuc.CardInviteService.
+type CardInviteService struct {
+	client *Client
+}
+
+var _ tuc.CardInviteService = &CardInviteService{}
+
+// NewCardInviteService returns a new instance of CardInviteService.
+func NewCardInviteService(c *Client) *CardInviteService {
+	return &CardInviteService{
+		client: c,
+	}
+}
+
+// Create an invite.
+func (s *CardInviteService) Create(ctx context.Context, invite *tuc.CardInvite) error {
+	item, _ := dynamodbattribute.MarshalMap(invite)
+	input := &dynamodb.PutItemInput{
+		Item:      item,
+		TableName: aws.String(s.client.tables.CardInvites),
+	}
+
+	req := s.client.svc.PutItemRequest(input)
+	req.SetContext(ctx)
+	_, err := req.Send()
+
+	return err
+}
+
+// Delete an invite.
+func (s *CardInviteService) Delete(ctx context.Context, cardID, email string) error {
+	input := &dynamodb.DeleteItemInput{
+		Key: map[string]dynamodb.AttributeValue{
+			"card_id": {
+				S: &cardID,
+			},
+			"email": {
+				S: &email,
+			},
+		},
+		TableName: aws.String(s.client.tables.CardInvites),
+	}
+
+	req := s.client.svc.DeleteItemRequest(input)
+	req.SetContext(ctx)
+	_, err := req.Send()
+
+	return err
+}
+
+// List the invites to a card.
+func (s *CardInviteService) List(ctx context.Context, cardID string) ([]tuc.CardInvite, error) {
+	return s.query(ctx, &dynamodb.QueryInput{
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":id": {
+				S: &cardID,
+			},
+		},
+		KeyConditionExpression: aws.String("card_id = :id"),
+		TableName:              aws.String(s.client.tables.CardInvites),
+	})
+}
+
+// ListByEmail lists the invites for an email.
+func (s *CardInviteService) ListByEmail(ctx context.Context, email string) ([]tuc.CardInvite, error) {
+	return s.query(ctx, &dynamodb.QueryInput{
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":e": {
+				S: &email,
+			},
+		},
+		IndexName:              aws.String(cardInvitesEmailIndex),
+		KeyConditionExpression: aws.String("email = :e"),
+		TableName:              aws.String(s.client.tables.CardInvites),
+	})
+}
+
+func (s *CardInviteService) query(ctx context.Context, input *dynamodb.QueryInput) ([]tuc.CardInvite, error) {
+	req := s.client.svc.QueryRequest(input)
+	req.SetContext(ctx)
+	res, err := req.Send()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "getting items")
+	}
+
+	invites := []tuc.CardInvite{}
+
+	if err := dynamodbattribute.UnmarshalListOfMaps(res.Items, &invites); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling items")
+	}
+
+	return invites, nil
+}
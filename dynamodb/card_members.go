@@ -0,0 +1,116 @@
+package dynamodb
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc"
+)
+
+// cardMembersUserIndex is the global secondary index of the card members
+// table keyed by u_id and card_id.
+const cardMembersUserIndex = "u_id-index"
+
+// Share a card.
+func (s *CardService) Share(ctx context.Context, member *tuc.CardMember) error {
+	item, _ := dynamodbattribute.MarshalMap(member)
+	input := &dynamodb.PutItemInput{
+		Item:      item,
+		TableName: aws.String(s.client.tables.CardMembers),
+	}
+
+	req := s.client.svc.PutItemRequest(input)
+	req.SetContext(ctx)
+	_, err := req.Send()
+
+	return err
+}
+
+// Unshare a card.
+func (s *CardService) Unshare(ctx context.Context, cardID, userID string) error {
+	input := &dynamodb.DeleteItemInput{
+		Key: map[string]dynamodb.AttributeValue{
+			"card_id": {
+				S: &cardID,
+			},
+			"u_id": {
+				S: &userID,
+			},
+		},
+		TableName: aws.String(s.client.tables.CardMembers),
+	}
+
+	req := s.client.svc.DeleteItemRequest(input)
+	req.SetContext(ctx)
+	_, err := req.Send()
+
+	return err
+}
+
+// Members of a card.
+func (s *CardService) Members(ctx context.Context, cardID string) ([]tuc.CardMember, error) {
+	input := &dynamodb.QueryInput{
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":id": {
+				S: &cardID,
+			},
+		},
+		KeyConditionExpression: aws.String("card_id = :id"),
+		TableName:              aws.String(s.client.tables.CardMembers),
+	}
+
+	req := s.client.svc.QueryRequest(input)
+	req.SetContext(ctx)
+	res, err := req.Send()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "getting items")
+	}
+
+	members := []tuc.CardMember{}
+
+	if err := dynamodbattribute.UnmarshalListOfMaps(res.Items, &members); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling items")
+	}
+
+	return members, nil
+}
+
+// member returns the membership of a user in a card, or nil.
+func (s *CardService) member(ctx context.Context, cardID, userID string) (*tuc.CardMember, error) {
+	input := &dynamodb.GetItemInput{
+		Key: map[string]dynamodb.AttributeValue{
+			"card_id": {
+				S: &cardID,
+			},
+			"u_id": {
+				S: &userID,
+			},
+		},
+		TableName: aws.String(s.client.tables.CardMembers),
+	}
+
+	req := s.client.svc.GetItemRequest(input)
+	req.SetContext(ctx)
+	res, err := req.Send()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "getting member")
+	}
+
+	if len(res.Item) == 0 {
+		return nil, nil
+	}
+
+	var m tuc.CardMember
+
+	if err := dynamodbattribute.UnmarshalMap(res.Item, &m); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling member")
+	}
+
+	return &m, nil
+}
@@ -1,11 +1,106 @@
 package dynamodb
 
 import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
 	"github.com/aws/aws-sdk-go-v2/aws/external"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbiface"
+	"github.com/pkg/errors"
 )
 
-var (
-	cfg, _ = external.LoadDefaultAWSConfig()
-	svc    = dynamodb.New(cfg)
-)
+// Config is the configuration for a Client.
+type Config struct {
+	// DB is the DynamoDB API used by the services. When nil a client is
+	// created from the default AWS config.
+	DB dynamodbiface.DynamoDBAPI
+
+	// Endpoint overrides the endpoint of the default client, for example to
+	// point at a local DynamoDB.
+	Endpoint string
+
+	// TablePrefix is prepended to the default table names.
+	TablePrefix string
+
+	// Tables overrides individual table names, ignoring TablePrefix.
+	Tables Tables
+}
+
+// Tables are the names of the tables used by the services.
+type Tables struct {
+	BalanceHistory string
+	CardEvents     string
+	CardInvites    string
+	CardMembers    string
+	Cards          string
+	Cursors        string
+	EmailChanges   string
+	LoginRequests  string
+	RefreshTokens  string
+	Revocations    string
+	UserEmails     string
+	UserIdentities string
+	Users          string
+}
+
+// Client is a DynamoDB client shared by the services.
+type Client struct {
+	svc    dynamodbiface.DynamoDBAPI
+	tables Tables
+}
+
+// NewClient returns a new Client for the given config.
+func NewClient(c Config) (*Client, error) {
+	svc := c.DB
+
+	if svc == nil {
+		cfg, err := external.LoadDefaultAWSConfig()
+
+		if err != nil {
+			return nil, errors.Wrap(err, "loading aws config")
+		}
+
+		if c.Endpoint != "" {
+			cfg.EndpointResolver = aws.ResolveWithEndpointURL(c.Endpoint)
+		}
+
+		svc = dynamodb.New(cfg)
+	}
+
+	return &Client{
+		svc: svc,
+		tables: Tables{
+			BalanceHistory: tableName(c.Tables.BalanceHistory, c.TablePrefix, "tuc_balance_history"),
+			CardEvents:     tableName(c.Tables.CardEvents, c.TablePrefix, "tuc_card_events"),
+			CardInvites:    tableName(c.Tables.CardInvites, c.TablePrefix, "tuc_card_invites"),
+			CardMembers:    tableName(c.Tables.CardMembers, c.TablePrefix, "tuc_card_members"),
+			Cards:          tableName(c.Tables.Cards, c.TablePrefix, "tuc_cards"),
+			Cursors:        tableName(c.Tables.Cursors, c.TablePrefix, "tuc_cursors"),
+			EmailChanges:   tableName(c.Tables.EmailChanges, c.TablePrefix, "tuc_email_changes"),
+			LoginRequests:  tableName(c.Tables.LoginRequests, c.TablePrefix, "tuc_login_requests"),
+			RefreshTokens:  tableName(c.Tables.RefreshTokens, c.TablePrefix, "tuc_refresh_tokens"),
+			Revocations:    tableName(c.Tables.Revocations, c.TablePrefix, "tuc_revocations"),
+			UserEmails:     tableName(c.Tables.UserEmails, c.TablePrefix, "tuc_user_emails"),
+			UserIdentities: tableName(c.Tables.UserIdentities, c.TablePrefix, "tuc_user_identities"),
+			Users:          tableName(c.Tables.Users, c.TablePrefix, "tuc_users"),
+		},
+	}, nil
+}
+
+// tableName returns name, or the prefixed default when name is empty.
+func tableName(name, prefix, def string) string {
+	if name != "" {
+		return name
+	}
+
+	return prefix + def
+}
+
+// conditionFailed reports whether err is a failed condition check.
+func conditionFailed(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+	}
+
+	return false
+}
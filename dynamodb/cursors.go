@@ -0,0 +1,85 @@
+package dynamodb
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc"
+)
+
+// CursorService represents an dynamodb implementation of tuc.CursorService.
+type CursorService struct {
+	client *Client
+}
+
+var _ tuc.CursorService = &CursorService{}
+
+// NewCursorService returns a new instance of CursorService.
+func NewCursorService(c *Client) *CursorService {
+	return &CursorService{
+		client: c,
+	}
+}
+
+// Get returns the cursor saved under name.
+func (s *CursorService) Get(ctx context.Context, name string) (string, error) {
+	input := &dynamodb.GetItemInput{
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]dynamodb.AttributeValue{
+			"name": {
+				S: &name,
+			},
+		},
+		TableName: aws.String(s.client.tables.Cursors),
+	}
+
+	req := s.client.svc.GetItemRequest(input)
+	req.SetContext(ctx)
+	res, err := req.Send()
+
+	if err != nil {
+		return "", errors.Wrap(err, "getting item")
+	}
+
+	return aws.StringValue(res.Item["cursor"].S), nil
+}
+
+// Put saves a cursor under name.
+func (s *CursorService) Put(ctx context.Context, name, cursor string) error {
+	key := map[string]dynamodb.AttributeValue{
+		"name": {
+			S: &name,
+		},
+	}
+
+	if cursor == "" {
+		input := &dynamodb.DeleteItemInput{
+			Key:       key,
+			TableName: aws.String(s.client.tables.Cursors),
+		}
+
+		req := s.client.svc.DeleteItemRequest(input)
+		req.SetContext(ctx)
+		_, err := req.Send()
+
+		return errors.Wrap(err, "deleting item")
+	}
+
+	key["cursor"] = dynamodb.AttributeValue{
+		S: &cursor,
+	}
+
+	input := &dynamodb.PutItemInput{
+		Item:      key,
+		TableName: aws.String(s.client.tables.Cursors),
+	}
+
+	req := s.client.svc.PutItemRequest(input)
+	req.SetContext(ctx)
+	_, err := req.Send()
+
+	return errors.Wrap(err, "putting item")
+}
@@ -0,0 +1,269 @@
+package dynamodb_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/external"
+	awsdynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/nerdify/tuc"
+	"github.com/nerdify/tuc/dynamodb"
+	"github.com/nerdify/tuc/servicetest"
+)
+
+// newClient returns a client backed by fresh tables on the DynamoDB at
+// DYNAMODB_TEST_ENDPOINT, skipping the test when it is not set.
+func newClient(t *testing.T) *dynamodb.Client {
+	endpoint := os.Getenv("DYNAMODB_TEST_ENDPOINT")
+
+	if endpoint == "" {
+		t.Skip("DYNAMODB_TEST_ENDPOINT not set")
+	}
+
+	cfg, err := external.LoadDefaultAWSConfig()
+	if err != nil {
+		t.Fatalf("loading aws config: %v", err)
+	}
+
+	cfg.EndpointResolver = aws.ResolveWithEndpointURL(endpoint)
+	svc := awsdynamodb.New(cfg)
+	prefix := "test_" + uuid.NewV4().String()[:8] + "_"
+	s, n := awsdynamodb.ScalarAttributeTypeS, awsdynamodb.ScalarAttributeTypeN
+
+	members := table(prefix+"tuc_card_members", key("card_id", s), key("u_id", s))
+	members.GlobalSecondaryIndexes = []awsdynamodb.GlobalSecondaryIndex{{
+		IndexName:             aws.String("u_id-index"),
+		KeySchema:             keySchema(key("u_id", s), key("card_id", s)),
+		Projection:            &awsdynamodb.Projection{ProjectionType: awsdynamodb.ProjectionTypeAll},
+		ProvisionedThroughput: members.ProvisionedThroughput,
+	}}
+
+	invites := table(prefix+"tuc_card_invites", key("card_id", s), key("email", s))
+	invites.GlobalSecondaryIndexes = []awsdynamodb.GlobalSecondaryIndex{{
+		IndexName:             aws.String("email-index"),
+		KeySchema:             keySchema(key("email", s), key("card_id", s)),
+		Projection:            &awsdynamodb.Projection{ProjectionType: awsdynamodb.ProjectionTypeAll},
+		ProvisionedThroughput: invites.ProvisionedThroughput,
+	}}
+
+	refreshTokens := table(prefix+"tuc_refresh_tokens", key("id", s), key("u_id", s))
+	refreshTokens.KeySchema = keySchema(key("id", s))
+	refreshTokens.GlobalSecondaryIndexes = []awsdynamodb.GlobalSecondaryIndex{{
+		IndexName:             aws.String("u_id-index"),
+		KeySchema:             keySchema(key("u_id", s)),
+		Projection:            &awsdynamodb.Projection{ProjectionType: awsdynamodb.ProjectionTypeKeysOnly},
+		ProvisionedThroughput: refreshTokens.ProvisionedThroughput,
+	}}
+
+	createTable(t, svc, table(prefix+"tuc_balance_history", key("card_id", s), key("ts", n)))
+	createTable(t, svc, table(prefix+"tuc_card_events", key("card_id", s), key("ts", n)))
+	createTable(t, svc, invites)
+	createTable(t, svc, members)
+	createTable(t, svc, table(prefix+"tuc_cards", key("u_id", s), key("id", s)))
+	createTable(t, svc, table(prefix+"tuc_cursors", key("name", s)))
+	createTable(t, svc, table(prefix+"tuc_email_changes", key("u_id", s)))
+	createTable(t, svc, table(prefix+"tuc_login_requests", key("u_id", s)))
+	createTable(t, svc, refreshTokens)
+	createTable(t, svc, table(prefix+"tuc_revocations", key("u_id", s)))
+	createTable(t, svc, table(prefix+"tuc_user_emails", key("email", s)))
+	createTable(t, svc, table(prefix+"tuc_user_identities", key("identity", s)))
+	createTable(t, svc, table(prefix+"tuc_users", key("id", s)))
+
+	c, err := dynamodb.NewClient(dynamodb.Config{
+		DB:          svc,
+		TablePrefix: prefix,
+	})
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	return c
+}
+
+// table returns the input to create a table with the given hash and
+// optional range key.
+func table(name string, keys ...awsdynamodb.AttributeDefinition) *awsdynamodb.CreateTableInput {
+	return &awsdynamodb.CreateTableInput{
+		AttributeDefinitions: keys,
+		KeySchema:            keySchema(keys...),
+		ProvisionedThroughput: &awsdynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(1),
+			WriteCapacityUnits: aws.Int64(1),
+		},
+		TableName: aws.String(name),
+	}
+}
+
+// createTable creates a table, deleted when the test finishes.
+func createTable(t *testing.T, svc *awsdynamodb.DynamoDB, input *awsdynamodb.CreateTableInput) {
+	t.Helper()
+
+	if _, err := svc.CreateTableRequest(input).Send(); err != nil {
+		t.Fatalf("creating table %s: %v", *input.TableName, err)
+	}
+
+	t.Cleanup(func() {
+		svc.DeleteTableRequest(&awsdynamodb.DeleteTableInput{TableName: input.TableName}).Send()
+	})
+}
+
+func keySchema(keys ...awsdynamodb.AttributeDefinition) []awsdynamodb.KeySchemaElement {
+	var schema []awsdynamodb.KeySchemaElement
+
+	for i, k := range keys {
+		keyType := awsdynamodb.KeyTypeHash
+
+		if i > 0 {
+			keyType = awsdynamodb.KeyTypeRange
+		}
+
+		schema = append(schema, awsdynamodb.KeySchemaElement{
+			AttributeName: k.AttributeName,
+			KeyType:       keyType,
+		})
+	}
+
+	return schema
+}
+
+func key(name string, typ awsdynamodb.ScalarAttributeType) awsdynamodb.AttributeDefinition {
+	return awsdynamodb.AttributeDefinition{
+		AttributeName: aws.String(name),
+		AttributeType: typ,
+	}
+}
+
+func TestCardService(t *testing.T) {
+	servicetest.TestCardService(t, dynamodb.NewCardService(newClient(t)))
+}
+
+func TestCardInviteService(t *testing.T) {
+	servicetest.TestCardInviteService(t, dynamodb.NewCardInviteService(newClient(t)))
+}
+
+func TestUserService(t *testing.T) {
+	servicetest.TestUserService(t, dynamodb.NewUserService(newClient(t)))
+}
+
+func TestLoginRequestService(t *testing.T) {
+	servicetest.TestLoginRequestService(t, dynamodb.NewLoginRequestService(newClient(t)))
+}
+
+func TestBalanceHistoryService(t *testing.T) {
+	servicetest.TestBalanceHistoryService(t, dynamodb.NewBalanceHistoryService(newClient(t)))
+}
+
+func TestCardEventService(t *testing.T) {
+	servicetest.TestCardEventService(t, dynamodb.NewCardEventService(newClient(t)))
+}
+
+func TestRefreshTokenService(t *testing.T) {
+	servicetest.TestRefreshTokenService(t, dynamodb.NewRefreshTokenService(newClient(t)))
+}
+
+func TestRevocationService(t *testing.T) {
+	servicetest.TestRevocationService(t, dynamodb.NewRevocationService(newClient(t)))
+}
+
+func TestCursorService(t *testing.T) {
+	servicetest.TestCursorService(t, dynamodb.NewCursorService(newClient(t)))
+}
+
+func TestEmailChangeService(t *testing.T) {
+	servicetest.TestEmailChangeService(t, dynamodb.NewEmailChangeService(newClient(t)))
+}
+
+func TestMigrateUsers(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(t)
+	users, cards := dynamodb.NewUserService(c), dynamodb.NewCardService(c)
+	logins, refreshTokens := dynamodb.NewLoginRequestService(c), dynamodb.NewRefreshTokenService(c)
+
+	// items as written when users were keyed by email
+	card := &tuc.Card{ID: "card", Name: "a", Number: "12345678", UserID: "a@b.c"}
+	login := &tuc.LoginRequest{RequestToken: "r", UserID: "a@b.c", VerificationToken: "v"}
+	refreshToken := &tuc.RefreshToken{ExpiresAt: time.Now().Add(time.Hour), FamilyID: "f", Hash: "h", UserID: "a@b.c"}
+
+	if err := users.Create(ctx, &tuc.User{ID: "a@b.c", Identities: map[string]string{"google": "g"}}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if err := cards.Create(ctx, card); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if err := cards.Share(ctx, &tuc.CardMember{CardID: "card", OwnerID: "a@b.c", Permission: tuc.CardPermissionRead, UserID: "m@b.c"}); err != nil {
+		t.Fatalf("Share: %v", err)
+	}
+
+	if err := logins.Create(ctx, login); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if err := refreshTokens.Create(ctx, refreshToken); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	ids := 0
+	newID := func() string {
+		ids++
+		return fmt.Sprintf("id%d", ids)
+	}
+
+	// a second run finds nothing left to migrate
+	for _, want := range []dynamodb.MigrationStats{{CardMembers: 1, Cards: 1, Identities: 1, LoginRequests: 1, RefreshTokens: 1, Users: 1}, {}} {
+		stats, err := dynamodb.MigrateUsers(ctx, c, newID)
+		if err != nil {
+			t.Fatalf("MigrateUsers: %v", err)
+		}
+
+		if *stats != want {
+			t.Fatalf("MigrateUsers = %+v, want %+v", *stats, want)
+		}
+	}
+
+	u, err := users.FindByEmail(ctx, "a@b.c")
+	if err != nil {
+		t.Fatalf("FindByEmail: %v", err)
+	}
+
+	if u == nil || u.ID != "id1" || u.Identities["google"] != "g" {
+		t.Fatalf("FindByEmail = %+v, want id1 with its identities", u)
+	}
+
+	if got, err := users.FindByIdentity(ctx, "google", "g"); err != nil || got == nil || got.ID != u.ID {
+		t.Fatalf("FindByIdentity = %+v, %v, want id1", got, err)
+	}
+
+	if got, err := cards.Get(ctx, u.ID, "card"); err != nil || got == nil {
+		t.Fatalf("Get = %+v, %v, want the card", got, err)
+	}
+
+	members, err := cards.Members(ctx, "card")
+	if err != nil {
+		t.Fatalf("Members: %v", err)
+	}
+
+	if m, _ := users.FindByEmail(ctx, "m@b.c"); m == nil || len(members) != 1 || members[0].UserID != m.ID || members[0].OwnerID != u.ID {
+		t.Fatalf("Members = %+v, want the member with a generated id", members)
+	}
+
+	if err := logins.Verify(ctx, u.ID, "v"); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	rotated, err := refreshTokens.Rotate(ctx, "f", "h", "next", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+
+	if rotated.UserID != u.ID {
+		t.Fatalf("Rotate = %+v, want user %s", rotated, u.ID)
+	}
+}
@@ -0,0 +1,161 @@
+package dynamodb
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc"
+)
+
+// EmailChangeService represents an dynamodb implementation of
+// tuc.EmailChangeService.
+//
+// Changes are deleted by the table TTL on expires_at, and their stream sends
+// the confirm and cancel links.
+type EmailChangeService struct {
+	client *Client
+}
+
+var _ tuc.EmailChangeService = &EmailChangeService{}
+
+// NewEmailChangeService returns a new instance of EmailChangeService.
+func NewEmailChangeService(c *Client) *EmailChangeService {
+	return &EmailChangeService{
+		client: c,
+	}
+}
+
+// Create an email change.
+func (s *EmailChangeService) Create(ctx context.Context, change *tuc.EmailChange) error {
+	item, err := dynamodbattribute.MarshalMap(change)
+
+	if err != nil {
+		return errors.Wrap(err, "marshaling item")
+	}
+
+	input := &dynamodb.PutItemInput{
+		ConditionExpression: aws.String("attribute_not_exists(u_id) or confirmed = :f or expires_at < :now"),
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":f": {
+				BOOL: aws.Bool(false),
+			},
+			":now": {
+				N: aws.String(strconv.FormatInt(time.Now().Unix(), 10)),
+			},
+		},
+		Item:      item,
+		TableName: aws.String(s.client.tables.EmailChanges),
+	}
+
+	req := s.client.svc.PutItemRequest(input)
+	req.SetContext(ctx)
+	_, err = req.Send()
+
+	if conditionFailed(err) {
+		return tuc.ErrEmailChangePending
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "putting item")
+	}
+
+	return nil
+}
+
+// Confirm an email change.
+func (s *EmailChangeService) Confirm(ctx context.Context, userID, token string, expiresAt time.Time) (*tuc.EmailChange, error) {
+	input := &dynamodb.UpdateItemInput{
+		ConditionExpression: aws.String("confirm_token = :t and confirmed = :f and expires_at > :now"),
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":e": {
+				N: aws.String(strconv.FormatInt(expiresAt.Unix(), 10)),
+			},
+			":f": {
+				BOOL: aws.Bool(false),
+			},
+			":now": {
+				N: aws.String(strconv.FormatInt(time.Now().Unix(), 10)),
+			},
+			":t": {
+				S: &token,
+			},
+			":true": {
+				BOOL: aws.Bool(true),
+			},
+		},
+		Key: map[string]dynamodb.AttributeValue{
+			"u_id": {
+				S: &userID,
+			},
+		},
+		ReturnValues:     dynamodb.ReturnValueAllNew,
+		TableName:        aws.String(s.client.tables.EmailChanges),
+		UpdateExpression: aws.String("SET confirmed = :true, expires_at = :e"),
+	}
+
+	req := s.client.svc.UpdateItemRequest(input)
+	req.SetContext(ctx)
+	res, err := req.Send()
+
+	if conditionFailed(err) {
+		return nil, tuc.ErrInvalidEmailChange
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "updating item")
+	}
+
+	return unmarshalEmailChange(res.Attributes)
+}
+
+// Cancel an email change.
+func (s *EmailChangeService) Cancel(ctx context.Context, userID, token string) (*tuc.EmailChange, error) {
+	input := &dynamodb.DeleteItemInput{
+		ConditionExpression: aws.String("cancel_token = :t and expires_at > :now"),
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":now": {
+				N: aws.String(strconv.FormatInt(time.Now().Unix(), 10)),
+			},
+			":t": {
+				S: &token,
+			},
+		},
+		Key: map[string]dynamodb.AttributeValue{
+			"u_id": {
+				S: &userID,
+			},
+		},
+		ReturnValues: dynamodb.ReturnValueAllOld,
+		TableName:    aws.String(s.client.tables.EmailChanges),
+	}
+
+	req := s.client.svc.DeleteItemRequest(input)
+	req.SetContext(ctx)
+	res, err := req.Send()
+
+	if conditionFailed(err) {
+		return nil, tuc.ErrInvalidEmailChange
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "deleting item")
+	}
+
+	return unmarshalEmailChange(res.Attributes)
+}
+
+func unmarshalEmailChange(item map[string]dynamodb.AttributeValue) (*tuc.EmailChange, error) {
+	var c tuc.EmailChange
+
+	if err := dynamodbattribute.UnmarshalMap(item, &c); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling item")
+	}
+
+	return &c, nil
+}
@@ -1,6 +1,8 @@
 package dynamodb
 
 import (
+	"context"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
@@ -8,31 +10,37 @@ import (
 	"github.com/nerdify/tuc"
 )
 
-var (
-	loginRequestsTable = "tuc_login_requests"
-)
-
 // LoginRequestService represents an dynamodb implementation of tuc.LoginRequestService.
-type LoginRequestService struct{}
+type LoginRequestService struct {
+	client *Client
+}
 
 var _ tuc.LoginRequestService = &LoginRequestService{}
 
+// NewLoginRequestService returns a new instance of LoginRequestService.
+func NewLoginRequestService(c *Client) *LoginRequestService {
+	return &LoginRequestService{
+		client: c,
+	}
+}
+
 // Create a new login request.
-func (s *LoginRequestService) Create(request *tuc.LoginRequest) error {
+func (s *LoginRequestService) Create(ctx context.Context, request *tuc.LoginRequest) error {
 	item, _ := dynamodbattribute.MarshalMap(request)
 	input := &dynamodb.PutItemInput{
 		Item:      item,
-		TableName: &loginRequestsTable,
+		TableName: aws.String(s.client.tables.LoginRequests),
 	}
 
-	req := svc.PutItemRequest(input)
+	req := s.client.svc.PutItemRequest(input)
+	req.SetContext(ctx)
 	_, err := req.Send()
 
 	return err
 }
 
 // Delete a login request.
-func (s *LoginRequestService) Delete(email, code string) error {
+func (s *LoginRequestService) Delete(ctx context.Context, userID, code string) error {
 	input := &dynamodb.DeleteItemInput{
 		ConditionExpression: aws.String("#t = :t and #v = :v"),
 		ExpressionAttributeNames: map[string]string{
@@ -49,20 +57,21 @@ func (s *LoginRequestService) Delete(email, code string) error {
 		},
 		Key: map[string]dynamodb.AttributeValue{
 			"u_id": {
-				S: &email,
+				S: &userID,
 			},
 		},
-		TableName: &loginRequestsTable,
+		TableName: aws.String(s.client.tables.LoginRequests),
 	}
 
-	req := svc.DeleteItemRequest(input)
+	req := s.client.svc.DeleteItemRequest(input)
+	req.SetContext(ctx)
 	_, err := req.Send()
 
-	return err
+	return loginRequestError(err)
 }
 
 // Verify a login request.
-func (s *LoginRequestService) Verify(email, token string) error {
+func (s *LoginRequestService) Verify(ctx context.Context, userID, token string) error {
 	input := &dynamodb.UpdateItemInput{
 		ConditionExpression: aws.String("#t = :t and #v = :vf"),
 		ExpressionAttributeNames: map[string]string{
@@ -82,15 +91,26 @@ func (s *LoginRequestService) Verify(email, token string) error {
 		},
 		Key: map[string]dynamodb.AttributeValue{
 			"u_id": {
-				S: &email,
+				S: &userID,
 			},
 		},
-		TableName:        &loginRequestsTable,
+		TableName:        aws.String(s.client.tables.LoginRequests),
 		UpdateExpression: aws.String("SET #v = :vt"),
 	}
 
-	req := svc.UpdateItemRequest(input)
+	req := s.client.svc.UpdateItemRequest(input)
+	req.SetContext(ctx)
 	_, err := req.Send()
 
+	return loginRequestError(err)
+}
+
+// loginRequestError translates a failed condition check into
+// tuc.ErrInvalidLoginRequest.
+func loginRequestError(err error) error {
+	if conditionFailed(err) {
+		return tuc.ErrInvalidLoginRequest
+	}
+
 	return err
 }
@@ -0,0 +1,379 @@
+package dynamodb
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc"
+)
+
+// MigrationStats counts the items rewritten by MigrateUsers.
+type MigrationStats struct {
+	CardMembers   int
+	Cards         int
+	Identities    int
+	LoginRequests int
+	RefreshTokens int
+	Users         int
+}
+
+// MigrateUsers gives the users keyed by their email, from before users had
+// generated ids, an id made by newID, and rewrites their users, cards, card
+// members, login requests and refresh tokens to it.
+//
+// It also claims the identities linked before identities were claimed, so
+// users are found by them.
+//
+// Emails stay claimed by the id they got, so a failed migration is resumed by
+// running it again. Rewritten login requests are new items to the stream, so
+// pending ones get their verification email again. Revocations are left to
+// expire.
+func MigrateUsers(ctx context.Context, c *Client, newID func() string) (*MigrationStats, error) {
+	m := &migration{
+		client: c,
+		ids:    make(map[string]string),
+		newID:  newID,
+		users:  NewUserService(c),
+	}
+
+	steps := []struct {
+		name string
+		fn   func(context.Context) error
+	}{
+		{"users", m.migrateUsers},
+		{"cards", m.migrateCards},
+		{"card members", m.migrateCardMembers},
+		{"login requests", m.migrateLoginRequests},
+		{"refresh tokens", m.migrateRefreshTokens},
+		{"identities", m.migrateIdentities},
+	}
+
+	for _, s := range steps {
+		if err := s.fn(ctx); err != nil {
+			return &m.stats, errors.Wrapf(err, "migrating %s", s.name)
+		}
+	}
+
+	return &m.stats, nil
+}
+
+type migration struct {
+	client *Client
+	ids    map[string]string
+	newID  func() string
+	stats  MigrationStats
+	users  *UserService
+}
+
+// legacy reports whether a user id is an email.
+func legacy(id string) bool {
+	return strings.Contains(id, "@")
+}
+
+// userID returns the id of the user with an email, creating the user when
+// there is none, like cards shared with people who never logged in.
+func (m *migration) userID(ctx context.Context, email string) (string, error) {
+	if id, ok := m.ids[email]; ok {
+		return id, nil
+	}
+
+	u, err := m.users.FindByEmail(ctx, email)
+
+	if err != nil {
+		return "", err
+	}
+
+	if u == nil {
+		u = &tuc.User{
+			Email: email,
+			ID:    m.newID(),
+		}
+
+		if err := m.users.Create(ctx, u); err != nil {
+			return "", errors.Wrap(err, "creating user")
+		}
+	}
+
+	m.ids[email] = u.ID
+
+	return u.ID, nil
+}
+
+func (m *migration) migrateUsers(ctx context.Context) error {
+	return m.scan(ctx, m.client.tables.Users, func(item map[string]dynamodb.AttributeValue) error {
+		email := aws.StringValue(item["id"].S)
+
+		if !legacy(email) {
+			return nil
+		}
+
+		var u tuc.User
+
+		if err := dynamodbattribute.UnmarshalMap(item, &u); err != nil {
+			return errors.Wrap(err, "unmarshaling item")
+		}
+
+		if err := legacyIdentities(item, &u); err != nil {
+			return err
+		}
+
+		id, err := m.userID(ctx, email)
+
+		if err != nil {
+			return err
+		}
+
+		u.Email = email
+		u.ID = id
+
+		migrated, _ := dynamodbattribute.MarshalMap(&u)
+
+		if err := m.put(ctx, m.client.tables.Users, migrated); err != nil {
+			return err
+		}
+
+		m.stats.Users++
+
+		return m.delete(ctx, m.client.tables.Users, key(item, "id"))
+	})
+}
+
+func (m *migration) migrateCards(ctx context.Context) error {
+	return m.scan(ctx, m.client.tables.Cards, func(item map[string]dynamodb.AttributeValue) error {
+		migrated, err := m.rewrite(ctx, item, "u_id")
+
+		if err != nil || migrated == nil {
+			return err
+		}
+
+		if err := m.put(ctx, m.client.tables.Cards, migrated); err != nil {
+			return err
+		}
+
+		m.stats.Cards++
+
+		return m.delete(ctx, m.client.tables.Cards, key(item, "u_id", "id"))
+	})
+}
+
+func (m *migration) migrateCardMembers(ctx context.Context) error {
+	return m.scan(ctx, m.client.tables.CardMembers, func(item map[string]dynamodb.AttributeValue) error {
+		migrated, err := m.rewrite(ctx, item, "u_id", "owner_id")
+
+		if err != nil || migrated == nil {
+			return err
+		}
+
+		if err := m.put(ctx, m.client.tables.CardMembers, migrated); err != nil {
+			return err
+		}
+
+		m.stats.CardMembers++
+
+		return m.delete(ctx, m.client.tables.CardMembers, key(item, "card_id", "u_id"))
+	})
+}
+
+func (m *migration) migrateLoginRequests(ctx context.Context) error {
+	return m.scan(ctx, m.client.tables.LoginRequests, func(item map[string]dynamodb.AttributeValue) error {
+		migrated, err := m.rewrite(ctx, item, "u_id")
+
+		if err != nil || migrated == nil {
+			return err
+		}
+
+		migrated["email"] = item["u_id"]
+
+		if err := m.put(ctx, m.client.tables.LoginRequests, migrated); err != nil {
+			return err
+		}
+
+		m.stats.LoginRequests++
+
+		return m.delete(ctx, m.client.tables.LoginRequests, key(item, "u_id"))
+	})
+}
+
+func (m *migration) migrateRefreshTokens(ctx context.Context) error {
+	return m.scan(ctx, m.client.tables.RefreshTokens, func(item map[string]dynamodb.AttributeValue) error {
+		migrated, err := m.rewrite(ctx, item, "u_id")
+
+		if err != nil || migrated == nil {
+			return err
+		}
+
+		// u_id is not part of the key, so the item is replaced in place
+		if err := m.put(ctx, m.client.tables.RefreshTokens, migrated); err != nil {
+			return err
+		}
+
+		m.stats.RefreshTokens++
+
+		return nil
+	})
+}
+
+func (m *migration) migrateIdentities(ctx context.Context) error {
+	return m.scan(ctx, m.client.tables.Users, func(item map[string]dynamodb.AttributeValue) error {
+		var u tuc.User
+
+		if err := dynamodbattribute.UnmarshalMap(item, &u); err != nil {
+			return errors.Wrap(err, "unmarshaling item")
+		}
+
+		if err := legacyIdentities(item, &u); err != nil {
+			return err
+		}
+
+		for provider, subject := range u.Identities {
+			c := m.users.identityClaim(provider, subject)
+			input := &dynamodb.PutItemInput{
+				ConditionExpression: aws.String("attribute_not_exists(identity)"),
+				Item: map[string]dynamodb.AttributeValue{
+					c.attr: {
+						S: &c.value,
+					},
+					"u_id": {
+						S: &u.ID,
+					},
+				},
+				TableName: &c.table,
+			}
+
+			// claimed when the user was keyed by its email
+			if u.Email != "" {
+				input.ConditionExpression = aws.String("attribute_not_exists(identity) or u_id = :e")
+				input.ExpressionAttributeValues = map[string]dynamodb.AttributeValue{
+					":e": {
+						S: &u.Email,
+					},
+				}
+			}
+
+			req := m.client.svc.PutItemRequest(input)
+			req.SetContext(ctx)
+			_, err := req.Send()
+
+			// claimed already, by this user or by another one first
+			if conditionFailed(err) {
+				continue
+			}
+
+			if err != nil {
+				return errors.Wrap(err, "claiming identity")
+			}
+
+			m.stats.Identities++
+		}
+
+		return nil
+	})
+}
+
+// rewrite returns a copy of an item with the legacy user ids of attrs
+// replaced by their new ids, or nil when it has none.
+func (m *migration) rewrite(ctx context.Context, item map[string]dynamodb.AttributeValue, attrs ...string) (map[string]dynamodb.AttributeValue, error) {
+	var migrated map[string]dynamodb.AttributeValue
+
+	for _, a := range attrs {
+		email := aws.StringValue(item[a].S)
+
+		if !legacy(email) {
+			continue
+		}
+
+		id, err := m.userID(ctx, email)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if migrated == nil {
+			migrated = make(map[string]dynamodb.AttributeValue, len(item))
+
+			for k, v := range item {
+				migrated[k] = v
+			}
+		}
+
+		migrated[a] = dynamodb.AttributeValue{
+			S: aws.String(id),
+		}
+	}
+
+	return migrated, nil
+}
+
+// key returns the attributes of an item among names.
+func key(item map[string]dynamodb.AttributeValue, names ...string) map[string]dynamodb.AttributeValue {
+	k := make(map[string]dynamodb.AttributeValue)
+
+	for _, n := range names {
+		if v, ok := item[n]; ok {
+			k[n] = v
+		}
+	}
+
+	return k
+}
+
+// scan calls fn with every item of a table.
+func (m *migration) scan(ctx context.Context, table string, fn func(map[string]dynamodb.AttributeValue) error) error {
+	input := &dynamodb.ScanInput{
+		ConsistentRead: aws.Bool(true),
+		TableName:      aws.String(table),
+	}
+
+	for {
+		req := m.client.svc.ScanRequest(input)
+		req.SetContext(ctx)
+		res, err := req.Send()
+
+		if err != nil {
+			return errors.Wrap(err, "scanning")
+		}
+
+		for _, item := range res.Items {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+
+		if len(res.LastEvaluatedKey) == 0 {
+			return nil
+		}
+
+		input.ExclusiveStartKey = res.LastEvaluatedKey
+	}
+}
+
+func (m *migration) put(ctx context.Context, table string, item map[string]dynamodb.AttributeValue) error {
+	input := &dynamodb.PutItemInput{
+		Item:      item,
+		TableName: aws.String(table),
+	}
+
+	req := m.client.svc.PutItemRequest(input)
+	req.SetContext(ctx)
+	_, err := req.Send()
+
+	return errors.Wrap(err, "putting item")
+}
+
+func (m *migration) delete(ctx context.Context, table string, k map[string]dynamodb.AttributeValue) error {
+	input := &dynamodb.DeleteItemInput{
+		Key:       k,
+		TableName: aws.String(table),
+	}
+
+	req := m.client.svc.DeleteItemRequest(input)
+	req.SetContext(ctx)
+	_, err := req.Send()
+
+	return errors.Wrap(err, "deleting item")
+}
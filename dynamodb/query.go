@@ -0,0 +1,152 @@
+package dynamodb
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc"
+)
+
+// timeRangeQuery returns a query for the items of a card keyed by card_id
+// and a ts timestamp in nanoseconds, between from and to and continuing after
+// cursor.
+func timeRangeQuery(table, cardID string, from, to time.Time, limit int, cursor string) (*dynamodb.QueryInput, error) {
+	lo, hi := int64(0), int64(math.MaxInt64)
+
+	if !from.IsZero() {
+		lo = from.UnixNano()
+	}
+
+	if !to.IsZero() {
+		hi = to.UnixNano()
+	}
+
+	input := &dynamodb.QueryInput{
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":id": {
+				S: &cardID,
+			},
+			":from": {
+				N: aws.String(strconv.FormatInt(lo, 10)),
+			},
+			":to": {
+				N: aws.String(strconv.FormatInt(hi, 10)),
+			},
+		},
+		KeyConditionExpression: aws.String("card_id = :id AND ts BETWEEN :from AND :to"),
+		TableName:              aws.String(table),
+	}
+
+	if limit > 0 {
+		input.Limit = aws.Int64(int64(limit))
+	}
+
+	if cursor != "" {
+		if _, err := strconv.ParseInt(cursor, 10, 64); err != nil {
+			return nil, tuc.ErrInvalidCursor
+		}
+
+		input.ExclusiveStartKey = map[string]dynamodb.AttributeValue{
+			"card_id": {
+				S: &cardID,
+			},
+			"ts": {
+				N: aws.String(cursor),
+			},
+		}
+	}
+
+	return input, nil
+}
+
+// nextCursor returns the cursor continuing a time range query.
+func nextCursor(res *dynamodb.QueryOutput) string {
+	if ts, ok := res.LastEvaluatedKey["ts"]; ok && ts.N != nil {
+		return *ts.N
+	}
+
+	return ""
+}
+
+// batchSize is the most items a BatchWriteItem takes.
+const batchSize = 25
+
+// deleteTimeRange deletes the items of a card from a table of time range
+// queries.
+func deleteTimeRange(ctx context.Context, c *Client, table, cardID string) error {
+	input, _ := timeRangeQuery(table, cardID, time.Time{}, time.Time{}, batchSize, "")
+	input.ProjectionExpression = aws.String("card_id, ts")
+
+	for {
+		req := c.svc.QueryRequest(input)
+		req.SetContext(ctx)
+		res, err := req.Send()
+
+		if err != nil {
+			return errors.Wrap(err, "querying items")
+		}
+
+		if err := batchDelete(ctx, c, table, res.Items); err != nil {
+			return err
+		}
+
+		if len(res.LastEvaluatedKey) == 0 {
+			return nil
+		}
+
+		input.ExclusiveStartKey = res.LastEvaluatedKey
+	}
+}
+
+// batchDelete deletes up to batchSize items of a table by key, retrying the
+// ones left unprocessed.
+func batchDelete(ctx context.Context, c *Client, table string, keys []map[string]dynamodb.AttributeValue) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	writes := make([]dynamodb.WriteRequest, len(keys))
+
+	for i, k := range keys {
+		writes[i] = dynamodb.WriteRequest{
+			DeleteRequest: &dynamodb.DeleteRequest{
+				Key: k,
+			},
+		}
+	}
+
+	items := map[string][]dynamodb.WriteRequest{
+		table: writes,
+	}
+
+	for {
+		req := c.svc.BatchWriteItemRequest(&dynamodb.BatchWriteItemInput{
+			RequestItems: items,
+		})
+		req.SetContext(ctx)
+		res, err := req.Send()
+
+		if err != nil {
+			return errors.Wrap(err, "deleting items")
+		}
+
+		if len(res.UnprocessedItems) == 0 {
+			return nil
+		}
+
+		items = res.UnprocessedItems
+
+		// unprocessed items are throttled
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package dynamodb
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc"
+)
+
+// refreshTokensUserIndex is the index of the refresh token families by user.
+const refreshTokensUserIndex = "u_id-index"
+
+// RefreshTokenService represents an dynamodb implementation of
+// tuc.RefreshTokenService.
+type RefreshTokenService struct {
+	client *Client
+}
+
+var _ tuc.RefreshTokenService = &RefreshTokenService{}
+
+// NewRefreshTokenService returns a new instance of RefreshTokenService.
+func NewRefreshTokenService(c *Client) *RefreshTokenService {
+	return &RefreshTokenService{
+		client: c,
+	}
+}
+
+// Create a refresh token family.
+func (s *RefreshTokenService) Create(ctx context.Context, token *tuc.RefreshToken) error {
+	item, err := dynamodbattribute.MarshalMap(token)
+
+	if err != nil {
+		return errors.Wrap(err, "marshaling item")
+	}
+
+	input := &dynamodb.PutItemInput{
+		Item:      item,
+		TableName: aws.String(s.client.tables.RefreshTokens),
+	}
+
+	req := s.client.svc.PutItemRequest(input)
+	req.SetContext(ctx)
+	_, err = req.Send()
+
+	return err
+}
+
+// Rotate a refresh token.
+//
+// The family is read first to tell reused tokens from invalid families, and
+// the update is conditioned on the hash still being the current one, so of two
+// concurrent rotations the second is seen as a reuse.
+func (s *RefreshTokenService) Rotate(ctx context.Context, familyID, hash, next string, expiresAt time.Time) (*tuc.RefreshToken, error) {
+	t, err := s.get(ctx, familyID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if t == nil || t.Revoked || !time.Now().Before(t.ExpiresAt) {
+		return nil, tuc.ErrInvalidRefreshToken
+	}
+
+	if t.Hash != hash {
+		if err := s.Revoke(ctx, familyID); err != nil {
+			return nil, err
+		}
+
+		return nil, tuc.ErrRefreshTokenReused
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		ConditionExpression: aws.String("#h = :h and revoked = :f"),
+		ExpressionAttributeNames: map[string]string{
+			"#h": "hash",
+		},
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":e": {
+				N: aws.String(strconv.FormatInt(expiresAt.Unix(), 10)),
+			},
+			":f": {
+				BOOL: aws.Bool(false),
+			},
+			":h": {
+				S: &hash,
+			},
+			":n": {
+				S: &next,
+			},
+		},
+		Key: map[string]dynamodb.AttributeValue{
+			"id": {
+				S: &familyID,
+			},
+		},
+		ReturnValues:     dynamodb.ReturnValueAllNew,
+		TableName:        aws.String(s.client.tables.RefreshTokens),
+		UpdateExpression: aws.String("SET #h = :n, expires_at = :e"),
+	}
+
+	req := s.client.svc.UpdateItemRequest(input)
+	req.SetContext(ctx)
+	res, err := req.Send()
+
+	if conditionFailed(err) {
+		return s.Rotate(ctx, familyID, hash, next, expiresAt)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "updating item")
+	}
+
+	var rotated tuc.RefreshToken
+
+	if err := dynamodbattribute.UnmarshalMap(res.Attributes, &rotated); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling item")
+	}
+
+	return &rotated, nil
+}
+
+// Revoke a refresh token family.
+func (s *RefreshTokenService) Revoke(ctx context.Context, familyID string) error {
+	input := &dynamodb.UpdateItemInput{
+		ConditionExpression: aws.String("attribute_exists(id)"),
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":t": {
+				BOOL: aws.Bool(true),
+			},
+		},
+		Key: map[string]dynamodb.AttributeValue{
+			"id": {
+				S: &familyID,
+			},
+		},
+		TableName:        aws.String(s.client.tables.RefreshTokens),
+		UpdateExpression: aws.String("SET revoked = :t"),
+	}
+
+	req := s.client.svc.UpdateItemRequest(input)
+	req.SetContext(ctx)
+	_, err := req.Send()
+
+	if conditionFailed(err) {
+		return nil
+	}
+
+	return err
+}
+
+// RevokeUser revokes the refresh token families of a user.
+func (s *RefreshTokenService) RevokeUser(ctx context.Context, userID string) error {
+	input := &dynamodb.QueryInput{
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":u": {
+				S: &userID,
+			},
+		},
+		IndexName:              aws.String(refreshTokensUserIndex),
+		KeyConditionExpression: aws.String("u_id = :u"),
+		ProjectionExpression:   aws.String("id"),
+		TableName:              aws.String(s.client.tables.RefreshTokens),
+	}
+
+	for {
+		req := s.client.svc.QueryRequest(input)
+		req.SetContext(ctx)
+		res, err := req.Send()
+
+		if err != nil {
+			return errors.Wrap(err, "getting items")
+		}
+
+		for _, item := range res.Items {
+			if err := s.Revoke(ctx, aws.StringValue(item["id"].S)); err != nil {
+				return errors.Wrap(err, "revoking family")
+			}
+		}
+
+		if len(res.LastEvaluatedKey) == 0 {
+			return nil
+		}
+
+		input.ExclusiveStartKey = res.LastEvaluatedKey
+	}
+}
+
+func (s *RefreshTokenService) get(ctx context.Context, familyID string) (*tuc.RefreshToken, error) {
+	input := &dynamodb.GetItemInput{
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]dynamodb.AttributeValue{
+			"id": {
+				S: &familyID,
+			},
+		},
+		TableName: aws.String(s.client.tables.RefreshTokens),
+	}
+
+	req := s.client.svc.GetItemRequest(input)
+	req.SetContext(ctx)
+	res, err := req.Send()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "getting item")
+	}
+
+	if len(res.Item) == 0 {
+		return nil, nil
+	}
+
+	var t tuc.RefreshToken
+
+	if err := dynamodbattribute.UnmarshalMap(res.Item, &t); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling item")
+	}
+
+	return &t, nil
+}
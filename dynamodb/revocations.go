@@ -0,0 +1,155 @@
+package dynamodb
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc"
+)
+
+// RevocationService represents an dynamodb implementation of
+// tuc.RevocationService.
+//
+// There is one item per user, deleted by the table TTL on expires_at once
+// every token it revokes expired.
+type RevocationService struct {
+	client *Client
+}
+
+var _ tuc.RevocationService = &RevocationService{}
+
+// NewRevocationService returns a new instance of RevocationService.
+func NewRevocationService(c *Client) *RevocationService {
+	return &RevocationService{
+		client: c,
+	}
+}
+
+// Find the revocation of a user.
+func (s *RevocationService) Find(ctx context.Context, userID string) (*tuc.Revocation, error) {
+	input := &dynamodb.GetItemInput{
+		Key: map[string]dynamodb.AttributeValue{
+			"u_id": {
+				S: &userID,
+			},
+		},
+		TableName: aws.String(s.client.tables.Revocations),
+	}
+
+	req := s.client.svc.GetItemRequest(input)
+	req.SetContext(ctx)
+	res, err := req.Send()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "getting item")
+	}
+
+	if len(res.Item) == 0 {
+		return nil, nil
+	}
+
+	var r tuc.Revocation
+
+	if err := dynamodbattribute.UnmarshalMap(res.Item, &r); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling item")
+	}
+
+	// the TTL deletes expired items some time later
+	if !time.Now().Before(r.ExpiresAt) {
+		return nil, nil
+	}
+
+	return &r, nil
+}
+
+// RevokeSession revokes the tokens of a session.
+func (s *RevocationService) RevokeSession(ctx context.Context, userID, sessionID string, expiresAt time.Time) error {
+	return s.update(ctx, userID, "SET expires_at = :e ADD sessions :s", expiresAt, map[string]dynamodb.AttributeValue{
+		":s": {
+			SS: []string{sessionID},
+		},
+	})
+}
+
+// RevokeAll revokes the tokens of a user.
+func (s *RevocationService) RevokeAll(ctx context.Context, userID string, before, expiresAt time.Time) error {
+	return s.update(ctx, userID, "SET expires_at = :e, not_before = :b", expiresAt, map[string]dynamodb.AttributeValue{
+		":b": {
+			N: aws.String(strconv.FormatInt(before.Unix(), 10)),
+		},
+	})
+}
+
+// update updates the revocation of a user, starting a new one when it
+// expired but was not deleted yet.
+func (s *RevocationService) update(ctx context.Context, userID, expr string, expiresAt time.Time, values map[string]dynamodb.AttributeValue) error {
+	now := aws.String(strconv.FormatInt(time.Now().Unix(), 10))
+
+	values[":e"] = dynamodb.AttributeValue{
+		N: aws.String(strconv.FormatInt(expiresAt.Unix(), 10)),
+	}
+	values[":now"] = dynamodb.AttributeValue{
+		N: now,
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		ConditionExpression:       aws.String("attribute_not_exists(u_id) or expires_at > :now"),
+		ExpressionAttributeValues: values,
+		Key: map[string]dynamodb.AttributeValue{
+			"u_id": {
+				S: &userID,
+			},
+		},
+		TableName:        aws.String(s.client.tables.Revocations),
+		UpdateExpression: aws.String(expr),
+	}
+
+	req := s.client.svc.UpdateItemRequest(input)
+	req.SetContext(ctx)
+	_, err := req.Send()
+
+	if !conditionFailed(err) {
+		return err
+	}
+
+	if err := s.delete(ctx, userID, now); err != nil {
+		return err
+	}
+
+	return s.update(ctx, userID, expr, expiresAt, values)
+}
+
+// delete deletes the revocation of a user if it expired.
+func (s *RevocationService) delete(ctx context.Context, userID string, now *string) error {
+	input := &dynamodb.DeleteItemInput{
+		ConditionExpression: aws.String("expires_at <= :now"),
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":now": {
+				N: now,
+			},
+		},
+		Key: map[string]dynamodb.AttributeValue{
+			"u_id": {
+				S: &userID,
+			},
+		},
+		TableName: aws.String(s.client.tables.Revocations),
+	}
+
+	req := s.client.svc.DeleteItemRequest(input)
+	req.SetContext(ctx)
+	_, err := req.Send()
+
+	// revoked again meanwhile
+	if conditionFailed(err) {
+		return nil
+	}
+
+	return err
+}
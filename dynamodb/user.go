@@ -1,6 +1,8 @@
 package dynamodb
 
 import (
+	"context"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
@@ -9,25 +11,37 @@ import (
 	"github.com/nerdify/tuc"
 )
 
-var usersTable = "tuc_users"
-
 // UserService represents an dynamodb implementation of tuc.UserService.
-type UserService struct{}
+//
+// Emails and identities are unique through an item per email in the user
+// emails table and per provider#subject in the user identities table, claimed
+// before the user is created or linked.
+type UserService struct {
+	client *Client
+}
 
 var _ tuc.UserService = &UserService{}
 
+// NewUserService returns a new instance of UserService.
+func NewUserService(c *Client) *UserService {
+	return &UserService{
+		client: c,
+	}
+}
+
 // Find returns the User with the specified id.
-func (s *UserService) Find(id string) (*tuc.User, error) {
+func (s *UserService) Find(ctx context.Context, id string) (*tuc.User, error) {
 	input := &dynamodb.GetItemInput{
 		Key: map[string]dynamodb.AttributeValue{
 			"id": {
 				S: &id,
 			},
 		},
-		TableName: &usersTable,
+		TableName: aws.String(s.client.tables.Users),
 	}
 
-	req := svc.GetItemRequest(input)
+	req := s.client.svc.GetItemRequest(input)
+	req.SetContext(ctx)
 	res, err := req.Send()
 
 	if err != nil {
@@ -44,42 +58,382 @@ func (s *UserService) Find(id string) (*tuc.User, error) {
 		return nil, errors.Wrap(err, "unmarshaling item")
 	}
 
+	if err := legacyIdentities(res.Item, &u); err != nil {
+		return nil, err
+	}
+
 	return &u, nil
 }
 
+// legacyIdentities adds the facebook and google ids stored before users had
+// identities, unless linked again since.
+func legacyIdentities(item map[string]dynamodb.AttributeValue, u *tuc.User) error {
+	var legacy struct {
+		FacebookID string `dynamodbav:"facebook_id"`
+		GoogleID   string `dynamodbav:"google_id"`
+	}
+
+	if err := dynamodbattribute.UnmarshalMap(item, &legacy); err != nil {
+		return errors.Wrap(err, "unmarshaling legacy ids")
+	}
+
+	for provider, subject := range map[string]string{"facebook": legacy.FacebookID, "google": legacy.GoogleID} {
+		if subject == "" || u.Identities[provider] != "" {
+			continue
+		}
+
+		if u.Identities == nil {
+			u.Identities = make(map[string]string)
+		}
+
+		u.Identities[provider] = subject
+	}
+
+	return nil
+}
+
+// FindByEmail returns the User with the specified email.
+func (s *UserService) FindByEmail(ctx context.Context, email string) (*tuc.User, error) {
+	return s.findClaimed(ctx, s.emailClaim(email))
+}
+
+// FindByIdentity returns the User linked to the subject of a provider.
+func (s *UserService) FindByIdentity(ctx context.Context, provider, subject string) (*tuc.User, error) {
+	return s.findClaimed(ctx, s.identityClaim(provider, subject))
+}
+
+// findClaimed returns the User who claimed c.
+func (s *UserService) findClaimed(ctx context.Context, c claim) (*tuc.User, error) {
+	input := &dynamodb.GetItemInput{
+		Key: map[string]dynamodb.AttributeValue{
+			c.attr: {
+				S: &c.value,
+			},
+		},
+		TableName: &c.table,
+	}
+
+	req := s.client.svc.GetItemRequest(input)
+	req.SetContext(ctx)
+	res, err := req.Send()
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting %s", c.attr)
+	}
+
+	if len(res.Item) == 0 {
+		return nil, nil
+	}
+
+	return s.Find(ctx, aws.StringValue(res.Item["u_id"].S))
+}
+
 // Create creates a new user.
-func (s *UserService) Create(user *tuc.User) error {
+func (s *UserService) Create(ctx context.Context, user *tuc.User) error {
+	var claims []claim
+
+	if user.Email != "" {
+		claims = append(claims, s.emailClaim(user.Email))
+	}
+
+	for provider, subject := range user.Identities {
+		claims = append(claims, s.identityClaim(provider, subject))
+	}
+
+	for i, c := range claims {
+		if err := s.claim(ctx, c, user.ID); err != nil {
+			return s.releaseAll(ctx, claims[:i], user.ID, err)
+		}
+	}
+
 	item, _ := dynamodbattribute.MarshalMap(user)
 	input := &dynamodb.PutItemInput{
 		Item:      item,
-		TableName: &usersTable,
+		TableName: aws.String(s.client.tables.Users),
 	}
 
-	req := svc.PutItemRequest(input)
+	req := s.client.svc.PutItemRequest(input)
+	req.SetContext(ctx)
 	_, err := req.Send()
 
+	if err != nil {
+		return s.releaseAll(ctx, claims, user.ID, errors.Wrap(err, "putting item"))
+	}
+
+	return nil
+}
+
+// releaseAll releases claims after err, leaving them free for the next
+// attempt.
+func (s *UserService) releaseAll(ctx context.Context, claims []claim, userID string, err error) error {
+	for _, c := range claims {
+		if rerr := s.release(ctx, c, userID); rerr != nil {
+			return errors.Wrapf(err, "releasing %s: %v", c.attr, rerr)
+		}
+	}
+
 	return err
 }
 
-// Update an user.
-func (s *UserService) Update(user *tuc.User) error {
+// ChangeEmail changes the email of an user, claiming the new email before
+// releasing the old one.
+func (s *UserService) ChangeEmail(ctx context.Context, id, email string) error {
+	u, err := s.Find(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	var old string
+
+	if u != nil {
+		old = u.Email
+	}
+
+	if old == email {
+		return nil
+	}
+
+	if err := s.claim(ctx, s.emailClaim(email), id); err != nil {
+		return err
+	}
+
 	input := &dynamodb.UpdateItemInput{
 		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
-			":fi": {
-				S: &user.FacebookID,
+			":e": {
+				S: &email,
 			},
 		},
 		Key: map[string]dynamodb.AttributeValue{
 			"id": {
-				S: &user.ID,
+				S: &id,
 			},
 		},
-		TableName:        &usersTable,
-		UpdateExpression: aws.String("SET facebook_id = :fi"),
+		TableName:        aws.String(s.client.tables.Users),
+		UpdateExpression: aws.String("SET email = :e"),
 	}
 
-	req := svc.UpdateItemRequest(input)
+	req := s.client.svc.UpdateItemRequest(input)
+	req.SetContext(ctx)
+	_, err = req.Send()
+
+	if err != nil {
+		return errors.Wrap(err, "updating item")
+	}
+
+	if old == "" {
+		return nil
+	}
+
+	return s.release(ctx, s.emailClaim(old), id)
+}
+
+// claim is the item of a unique value of users in a table keyed by attr.
+type claim struct {
+	attr  string
+	table string
+	taken error
+	value string
+}
+
+func (s *UserService) emailClaim(email string) claim {
+	return claim{
+		attr:  "email",
+		table: s.client.tables.UserEmails,
+		taken: tuc.ErrEmailTaken,
+		value: email,
+	}
+}
+
+func (s *UserService) identityClaim(provider, subject string) claim {
+	return claim{
+		attr:  "identity",
+		table: s.client.tables.UserIdentities,
+		taken: tuc.ErrIdentityTaken,
+		value: provider + "#" + subject,
+	}
+}
+
+// claim claims a value for a user, unless another user has it.
+func (s *UserService) claim(ctx context.Context, c claim, userID string) error {
+	input := &dynamodb.PutItemInput{
+		ConditionExpression: aws.String("attribute_not_exists(#a) or u_id = :u"),
+		ExpressionAttributeNames: map[string]string{
+			"#a": c.attr,
+		},
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":u": {
+				S: &userID,
+			},
+		},
+		Item: map[string]dynamodb.AttributeValue{
+			c.attr: {
+				S: &c.value,
+			},
+			"u_id": {
+				S: &userID,
+			},
+		},
+		TableName: &c.table,
+	}
+
+	req := s.client.svc.PutItemRequest(input)
+	req.SetContext(ctx)
+	_, err := req.Send()
+
+	if conditionFailed(err) {
+		return c.taken
+	}
+
+	return err
+}
+
+// release deletes the claim of a user on a value.
+func (s *UserService) release(ctx context.Context, c claim, userID string) error {
+	input := &dynamodb.DeleteItemInput{
+		ConditionExpression: aws.String("u_id = :u"),
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":u": {
+				S: &userID,
+			},
+		},
+		Key: map[string]dynamodb.AttributeValue{
+			c.attr: {
+				S: &c.value,
+			},
+		},
+		TableName: &c.table,
+	}
+
+	req := s.client.svc.DeleteItemRequest(input)
+	req.SetContext(ctx)
+	_, err := req.Send()
+
+	if conditionFailed(err) {
+		return nil
+	}
+
+	return err
+}
+
+// Link an identity to an user, claiming the subject before releasing the one
+// it replaces.
+func (s *UserService) Link(ctx context.Context, id, provider, subject string) error {
+	u, err := s.Find(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	var old string
+
+	if u != nil {
+		old = u.Identities[provider]
+	}
+
+	if err := s.claim(ctx, s.identityClaim(provider, subject), id); err != nil {
+		return err
+	}
+
+	if err := s.link(ctx, id, provider, subject); err != nil {
+		return errors.Wrap(err, "updating item")
+	}
+
+	if old == "" || old == subject {
+		return nil
+	}
+
+	return s.release(ctx, s.identityClaim(provider, old), id)
+}
+
+// link sets the subject of a provider on an user.
+//
+// A nested attribute can only be set once its map exists, so the map is
+// created when the first identity is linked.
+func (s *UserService) link(ctx context.Context, id, provider, subject string) error {
+	input := &dynamodb.UpdateItemInput{
+		ConditionExpression: aws.String("attribute_exists(identities)"),
+		ExpressionAttributeNames: map[string]string{
+			"#p": provider,
+		},
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":s": {
+				S: &subject,
+			},
+		},
+		Key: map[string]dynamodb.AttributeValue{
+			"id": {
+				S: &id,
+			},
+		},
+		TableName:        aws.String(s.client.tables.Users),
+		UpdateExpression: aws.String("SET identities.#p = :s"),
+	}
+
+	req := s.client.svc.UpdateItemRequest(input)
+	req.SetContext(ctx)
 	_, err := req.Send()
 
+	if !conditionFailed(err) {
+		return err
+	}
+
+	input = &dynamodb.UpdateItemInput{
+		ConditionExpression: aws.String("attribute_not_exists(identities)"),
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":i": {
+				M: map[string]dynamodb.AttributeValue{
+					provider: {
+						S: &subject,
+					},
+				},
+			},
+		},
+		Key: map[string]dynamodb.AttributeValue{
+			"id": {
+				S: &id,
+			},
+		},
+		TableName:        aws.String(s.client.tables.Users),
+		UpdateExpression: aws.String("SET identities = :i"),
+	}
+
+	req = s.client.svc.UpdateItemRequest(input)
+	req.SetContext(ctx)
+	_, err = req.Send()
+
+	// another identity was linked meanwhile
+	if conditionFailed(err) {
+		return s.link(ctx, id, provider, subject)
+	}
+
+	return err
+}
+
+// UpdateNotifications sets the notification preferences of an user.
+func (s *UserService) UpdateNotifications(ctx context.Context, id string, prefs *tuc.NotificationPreferences) error {
+	av, err := dynamodbattribute.Marshal(prefs)
+
+	if err != nil {
+		return errors.Wrap(err, "marshaling preferences")
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":n": *av,
+		},
+		Key: map[string]dynamodb.AttributeValue{
+			"id": {
+				S: &id,
+			},
+		},
+		TableName:        aws.String(s.client.tables.Users),
+		UpdateExpression: aws.String("SET notifications = :n"),
+	}
+
+	req := s.client.svc.UpdateItemRequest(input)
+	req.SetContext(ctx)
+	_, err = req.Send()
+
 	return err
 }
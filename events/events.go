@@ -0,0 +1,97 @@
+// Package events records balance readings and detects recharges and trips
+// from them.
+package events
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/nerdify/tuc"
+	"github.com/nerdify/tuc/fare"
+)
+
+// Detector classifies the change between two readings of a card.
+type Detector struct {
+	// Fares prices the trips at the time of the current reading.
+	Fares *fare.Table
+}
+
+// Detect returns the event between the previous and current readings, or nil
+// when the balance did not change.
+//
+// An increase is a recharge. A decrease that is a multiple of the fare at the
+// time of the current reading, or else of a route fare, is that many trips,
+// and any other decrease is an adjustment.
+func (d *Detector) Detect(prev, curr *tuc.BalanceSnapshot) *tuc.CardEvent {
+	// compare in cents to avoid floating point noise
+	delta := cents(curr.Balance) - cents(prev.Balance)
+
+	if delta == 0 {
+		return nil
+	}
+
+	e := &tuc.CardEvent{
+		Amount:  float64(abs(delta)) / 100,
+		Balance: curr.Balance,
+		CardID:  curr.CardID,
+		Time:    curr.Time,
+	}
+
+	trips := d.trips(-delta, curr.Time)
+
+	switch {
+	case delta > 0:
+		e.Type = tuc.CardEventRecharge
+	case trips > 0:
+		e.Type = tuc.CardEventTrip
+		e.Trips = trips
+	default:
+		e.Type = tuc.CardEventAdjustment
+	}
+
+	return e
+}
+
+// trips returns how many trips a decrease of amount cents at t pays for, or
+// zero when no fare fits. Readings don't tell the route, so every route fare
+// is tried after the fare at t.
+func (d *Detector) trips(amount int64, at time.Time) int {
+	if d.Fares == nil || amount <= 0 {
+		return 0
+	}
+
+	routes := make([]string, 0, len(d.Fares.Routes))
+
+	for r := range d.Fares.Routes {
+		routes = append(routes, r)
+	}
+
+	sort.Strings(routes)
+
+	fares := []float64{d.Fares.Fare("", at)}
+
+	for _, r := range routes {
+		fares = append(fares, d.Fares.Routes[r])
+	}
+
+	for _, f := range fares {
+		if f := cents(f); f > 0 && amount%f == 0 {
+			return int(amount / f)
+		}
+	}
+
+	return 0
+}
+
+func cents(v float64) int64 {
+	return int64(math.Round(v * 100))
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
@@ -0,0 +1,128 @@
+package events_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nerdify/tuc"
+	"github.com/nerdify/tuc/events"
+	"github.com/nerdify/tuc/fare"
+)
+
+func TestDetect(t *testing.T) {
+	now := time.Date(2018, 5, 1, 23, 0, 0, 0, time.UTC)
+
+	// a night fare, and a route fare
+	fares := &fare.Table{
+		Default: 2.5,
+		Periods: []fare.Period{{Start: 22 * time.Hour, End: 5 * time.Hour, Fare: 3}},
+		Routes:  map[string]float64{"110": 5},
+	}
+
+	tests := map[string]struct {
+		fares      *fare.Table
+		prev, curr float64
+		want       *tuc.CardEvent
+	}{
+		"unchanged": {
+			fares: flat(2.5),
+			prev:  10,
+			curr:  10,
+		},
+		"unchanged within float noise": {
+			fares: flat(2.5),
+			prev:  0.3,
+			curr:  0.1 + 0.2,
+		},
+		"recharge": {
+			fares: flat(2.5),
+			prev:  10,
+			curr:  30,
+			want:  &tuc.CardEvent{Amount: 20, Balance: 30, Type: tuc.CardEventRecharge},
+		},
+		"single trip": {
+			fares: flat(2.5),
+			prev:  10,
+			curr:  7.5,
+			want:  &tuc.CardEvent{Amount: 2.5, Balance: 7.5, Trips: 1, Type: tuc.CardEventTrip},
+		},
+		"multiple trips": {
+			fares: flat(2.5),
+			prev:  10,
+			curr:  2.5,
+			want:  &tuc.CardEvent{Amount: 7.5, Balance: 2.5, Trips: 3, Type: tuc.CardEventTrip},
+		},
+		"non-multiple decrease": {
+			fares: flat(2.5),
+			prev:  10,
+			curr:  9,
+			want:  &tuc.CardEvent{Amount: 1, Balance: 9, Type: tuc.CardEventAdjustment},
+		},
+		"zero fare": {
+			fares: flat(0),
+			prev:  10,
+			curr:  7.5,
+			want:  &tuc.CardEvent{Amount: 2.5, Balance: 7.5, Type: tuc.CardEventAdjustment},
+		},
+		"float cent rounding": {
+			fares: flat(2.1),
+			prev:  10.3,
+			curr:  10.3 - 2.1,
+			want:  &tuc.CardEvent{Amount: 2.1, Balance: 10.3 - 2.1, Trips: 1, Type: tuc.CardEventTrip},
+		},
+		"no fares": {
+			prev: 10,
+			curr: 7.5,
+			want: &tuc.CardEvent{Amount: 2.5, Balance: 7.5, Type: tuc.CardEventAdjustment},
+		},
+		"period fare": {
+			fares: fares,
+			prev:  10,
+			curr:  4,
+			want:  &tuc.CardEvent{Amount: 6, Balance: 4, Trips: 2, Type: tuc.CardEventTrip},
+		},
+		"default fare outside the period": {
+			fares: fares,
+			prev:  10,
+			curr:  7.5,
+			want:  &tuc.CardEvent{Amount: 2.5, Balance: 7.5, Type: tuc.CardEventAdjustment},
+		},
+		"route fare": {
+			fares: fares,
+			prev:  10,
+			curr:  5,
+			want:  &tuc.CardEvent{Amount: 5, Balance: 5, Trips: 1, Type: tuc.CardEventTrip},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &events.Detector{Fares: tt.fares}
+
+			got := d.Detect(
+				&tuc.BalanceSnapshot{Balance: tt.prev, CardID: "c"},
+				&tuc.BalanceSnapshot{Balance: tt.curr, CardID: "c", Time: now},
+			)
+
+			if tt.want == nil {
+				if got != nil {
+					t.Fatalf("Detect = %+v, want nil", got)
+				}
+
+				return
+			}
+
+			tt.want.CardID = "c"
+			tt.want.Time = now
+
+			if got == nil || *got != *tt.want {
+				t.Fatalf("Detect = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// flat returns a table with a single fare.
+func flat(f float64) *fare.Table {
+	return &fare.Table{Default: f}
+}
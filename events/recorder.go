@@ -0,0 +1,100 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc"
+)
+
+// Recorder records balance readings of cards.
+type Recorder struct {
+	BalanceHistoryService tuc.BalanceHistoryService
+	CardEventService      tuc.CardEventService
+	CardService           tuc.CardService
+	Detector              *Detector
+}
+
+// Append appends the first reading of a card to its history.
+//
+// Failures to keep the history are only logged, since the reading itself
+// succeeded.
+func (r *Recorder) Append(ctx context.Context, cardID string, balance float64) {
+	r.append(ctx, &tuc.BalanceSnapshot{
+		Balance: balance,
+		CardID:  cardID,
+		Time:    time.Now().UTC(),
+	})
+}
+
+// Record records a new reading of a card. It appends the reading to the
+// history and updates the stored balance of the card, creating the event
+// since it once the update succeeds, and returns nil when the card was
+// deleted.
+//
+// The update is conditional on the balance the card was read with, so
+// concurrent readings of a card create the event between them once. When
+// another reading was recorded first, the card is read again and the event is
+// detected from its balance.
+//
+// Failures to keep the history or events are only logged, since the reading
+// itself succeeded.
+func (r *Recorder) Record(ctx context.Context, card *tuc.Card, balance float64) (*tuc.Card, error) {
+	curr := &tuc.BalanceSnapshot{
+		Balance: balance,
+		CardID:  card.ID,
+		Time:    time.Now().UTC(),
+	}
+
+	r.append(ctx, curr)
+
+	return r.record(ctx, card, curr)
+}
+
+func (r *Recorder) record(ctx context.Context, card *tuc.Card, curr *tuc.BalanceSnapshot) (*tuc.Card, error) {
+	c, err := r.CardService.Update(ctx, card.UserID, card.ID, card.Balance, curr.Balance)
+
+	if errors.Cause(err) == tuc.ErrBalanceChanged {
+		card, err = r.CardService.Get(ctx, card.UserID, card.ID)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "loading card")
+		}
+
+		if card == nil {
+			return nil, nil
+		}
+
+		return r.record(ctx, card, curr)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "updating card")
+	}
+
+	if c == nil {
+		return nil, nil
+	}
+
+	prev := &tuc.BalanceSnapshot{
+		Balance: card.Balance,
+		CardID:  card.ID,
+	}
+
+	if e := r.Detector.Detect(prev, curr); e != nil {
+		if err := r.CardEventService.Create(ctx, e); err != nil {
+			log.WithField("card", card.ID).WithError(err).Error("creating event")
+		}
+	}
+
+	return c, nil
+}
+
+func (r *Recorder) append(ctx context.Context, snapshot *tuc.BalanceSnapshot) {
+	if err := r.BalanceHistoryService.Append(ctx, snapshot); err != nil {
+		log.WithField("card", snapshot.CardID).WithError(err).Error("appending snapshot")
+	}
+}
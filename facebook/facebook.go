@@ -0,0 +1,155 @@
+// Package facebook verifies Facebook access tokens.
+package facebook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc"
+)
+
+// GraphURL is the base url of the Graph API.
+const GraphURL = "https://graph.facebook.com"
+
+// Provider is the Facebook identity provider. It only accepts tokens issued
+// to its app.
+type Provider struct {
+	AppID     string
+	AppSecret string
+
+	// GraphURL overrides the base url of the Graph API, for example to point
+	// at a local stub.
+	GraphURL string
+
+	HTTPClient *http.Client
+}
+
+var _ tuc.IdentityProvider = &Provider{}
+
+// NewProvider returns a new instance of Provider.
+func NewProvider(appID, appSecret string) *Provider {
+	return &Provider{
+		AppID:      appID,
+		AppSecret:  appSecret,
+		GraphURL:   GraphURL,
+		HTTPClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Name returns "facebook".
+func (p *Provider) Name() string {
+	return "facebook"
+}
+
+// Verify verifies an access token was issued to the app and is valid, and
+// reads the user it belongs to.
+func (p *Provider) Verify(ctx context.Context, token string) (*tuc.Identity, error) {
+	if p.AppID == "" || p.AppSecret == "" {
+		return nil, errors.New("facebook app not configured")
+	}
+
+	if token == "" {
+		return nil, errors.Wrap(tuc.ErrInvalidIdentityToken, "empty token")
+	}
+
+	var debug struct {
+		Data struct {
+			AppID   string `json:"app_id"`
+			IsValid bool   `json:"is_valid"`
+			UserID  string `json:"user_id"`
+		} `json:"data"`
+	}
+
+	err := p.get(ctx, "/debug_token", url.Values{
+		"access_token": {p.AppID + "|" + p.AppSecret},
+		"input_token":  {token},
+	}, &debug)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "debugging token")
+	}
+
+	if !debug.Data.IsValid {
+		return nil, errors.Wrap(tuc.ErrInvalidIdentityToken, "token is not valid")
+	}
+
+	if debug.Data.AppID != p.AppID {
+		return nil, errors.Wrapf(tuc.ErrInvalidIdentityToken, "token issued to app %s", debug.Data.AppID)
+	}
+
+	var me struct {
+		Email string `json:"email"`
+		ID    string `json:"id"`
+	}
+
+	err = p.get(ctx, "/me", url.Values{
+		"access_token":    {token},
+		"appsecret_proof": {p.proof(token)},
+		"fields":          {"email,id"},
+	}, &me)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "reading user")
+	}
+
+	if me.ID != debug.Data.UserID {
+		return nil, errors.Wrap(tuc.ErrInvalidIdentityToken, "user mismatch")
+	}
+
+	if me.Email == "" {
+		return nil, errors.Wrap(tuc.ErrInvalidIdentityToken, "no email")
+	}
+
+	return &tuc.Identity{
+		Email:   me.Email,
+		Subject: me.ID,
+	}, nil
+}
+
+// proof returns the appsecret_proof of a token.
+func (p *Provider) proof(token string) string {
+	mac := hmac.New(sha256.New, []byte(p.AppSecret))
+	mac.Write([]byte(token))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// get decodes a Graph API response into v. Client errors are returned as
+// ErrInvalidIdentityToken, since they come from tokens Graph rejects.
+func (p *Provider) get(ctx context.Context, path string, q url.Values, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, p.GraphURL+path+"?"+q.Encode(), nil)
+
+	if err != nil {
+		return errors.Wrap(err, "creating request")
+	}
+
+	res, err := p.HTTPClient.Do(req.WithContext(ctx))
+
+	if err != nil {
+		return errors.Wrap(err, "requesting")
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 && res.StatusCode < 500 {
+		return errors.Wrapf(tuc.ErrInvalidIdentityToken, "status %d", res.StatusCode)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("status %d", res.StatusCode)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return errors.Wrap(err, "parsing response")
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package facebook_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc"
+	"github.com/nerdify/tuc/facebook"
+)
+
+const (
+	appID     = "app"
+	appSecret = "secret"
+)
+
+// token is an access token known to the stub.
+type token struct {
+	AppID  string
+	Email  string
+	UserID string
+	Valid  bool
+}
+
+// newGraph returns a stub of the Graph API which knows the given tokens.
+func newGraph(t *testing.T, tokens map[string]token) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		switch r.URL.Path {
+		case "/debug_token":
+			if q.Get("access_token") != appID+"|"+appSecret {
+				http.Error(w, "bad app token", http.StatusBadRequest)
+				return
+			}
+
+			tok := tokens[q.Get("input_token")]
+			data := map[string]interface{}{
+				"app_id":   tok.AppID,
+				"is_valid": tok.Valid,
+				"user_id":  tok.UserID,
+			}
+
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+		case "/me":
+			tok, ok := tokens[q.Get("access_token")]
+
+			if !ok || !tok.Valid {
+				http.Error(w, "invalid token", http.StatusBadRequest)
+				return
+			}
+
+			mac := hmac.New(sha256.New, []byte(appSecret))
+			mac.Write([]byte(q.Get("access_token")))
+
+			if q.Get("appsecret_proof") != hex.EncodeToString(mac.Sum(nil)) {
+				http.Error(w, "invalid appsecret_proof", http.StatusBadRequest)
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]string{
+				"email": tok.Email,
+				"id":    tok.UserID,
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func TestVerify(t *testing.T) {
+	graph := newGraph(t, map[string]token{
+		"ours":     {AppID: appID, Email: "a@b.c", UserID: "1", Valid: true},
+		"theirs":   {AppID: "other", Email: "a@b.c", UserID: "1", Valid: true},
+		"expired":  {AppID: appID, Email: "a@b.c", UserID: "1"},
+		"no email": {AppID: appID, UserID: "1", Valid: true},
+	})
+
+	p := facebook.NewProvider(appID, appSecret)
+	p.GraphURL = graph.URL
+
+	identity, err := p.Verify(context.Background(), "ours")
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	if *identity != (tuc.Identity{Email: "a@b.c", Subject: "1"}) {
+		t.Fatalf("Verify = %+v", identity)
+	}
+
+	for _, tok := range []string{"theirs", "expired", "no email", "unknown", ""} {
+		t.Run(tok, func(t *testing.T) {
+			_, err := p.Verify(context.Background(), tok)
+			if errors.Cause(err) != tuc.ErrInvalidIdentityToken {
+				t.Fatalf("Verify = %v, want %v", err, tuc.ErrInvalidIdentityToken)
+			}
+		})
+	}
+}
+
+func TestVerifyGraphUnavailable(t *testing.T) {
+	graph := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer graph.Close()
+
+	p := facebook.NewProvider(appID, appSecret)
+	p.GraphURL = graph.URL
+
+	_, err := p.Verify(context.Background(), "ours")
+	if err == nil || errors.Cause(err) == tuc.ErrInvalidIdentityToken {
+		t.Fatalf("Verify = %v, want an error reaching graph", err)
+	}
+}
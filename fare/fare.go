@@ -0,0 +1,196 @@
+// Package fare provides fare tables to price trips.
+package fare
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultFare is the urban fare.
+const DefaultFare = 2.5
+
+// Table is a fare table with a default fare and per-route or time of day
+// overrides. A route override takes precedence over a period.
+type Table struct {
+	Default  float64
+	Location *time.Location
+	Periods  []Period
+	Routes   map[string]float64
+}
+
+// Period is a fare for a time of day, from Start up to End, crossing midnight
+// when End is before Start.
+type Period struct {
+	End   time.Duration
+	Fare  float64
+	Start time.Duration
+}
+
+// Default returns a table with the urban fare.
+func Default() *Table {
+	return &Table{
+		Default:  DefaultFare,
+		Location: time.UTC,
+	}
+}
+
+// Fare returns the fare of a trip on route at t. An empty route uses the
+// default or the period fare.
+func (t *Table) Fare(route string, at time.Time) float64 {
+	if f, ok := t.Routes[route]; ok && route != "" {
+		return f
+	}
+
+	loc := t.Location
+
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	at = at.In(loc)
+	tod := time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute + time.Duration(at.Second())*time.Second
+
+	for _, p := range t.Periods {
+		if p.contains(tod) {
+			return p.Fare
+		}
+	}
+
+	return t.Default
+}
+
+func (p Period) contains(tod time.Duration) bool {
+	if p.Start <= p.End {
+		return tod >= p.Start && tod < p.End
+	}
+
+	return tod >= p.Start || tod < p.End
+}
+
+// TripsRemaining returns the number of trips the balance pays for.
+func TripsRemaining(balance, fare float64) int {
+	if fare <= 0 || balance <= 0 {
+		return 0
+	}
+
+	// compare in cents to avoid floating point noise
+	return int(math.Round(balance*100)) / int(math.Round(fare*100))
+}
+
+// config is the JSON configuration of a Table.
+type config struct {
+	Default  float64            `json:"default"`
+	Timezone string             `json:"timezone"`
+	Routes   map[string]float64 `json:"routes"`
+	Periods  []struct {
+		End   string  `json:"end"`
+		Fare  float64 `json:"fare"`
+		Start string  `json:"start"`
+	} `json:"periods"`
+}
+
+// Load returns a table read from a JSON config, for example:
+//
+//	{
+//	  "default": 2.5,
+//	  "timezone": "America/Managua",
+//	  "routes": { "110": 5 },
+//	  "periods": [{ "start": "22:00", "end": "05:00", "fare": 3 }]
+//	}
+//
+// A missing default is the urban fare. Any other fare must be positive, since
+// trips are detected and counted by it.
+func Load(r io.Reader) (*Table, error) {
+	var c config
+
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return nil, errors.Wrap(err, "parsing config")
+	}
+
+	if c.Default < 0 {
+		return nil, errors.Errorf("invalid default fare %v", c.Default)
+	}
+
+	for route, f := range c.Routes {
+		if f <= 0 {
+			return nil, errors.Errorf("invalid fare %v of route %q", f, route)
+		}
+	}
+
+	t := Default()
+	t.Routes = c.Routes
+
+	if c.Default > 0 {
+		t.Default = c.Default
+	}
+
+	if c.Timezone != "" {
+		loc, err := time.LoadLocation(c.Timezone)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "loading timezone")
+		}
+
+		t.Location = loc
+	}
+
+	for _, cp := range c.Periods {
+		if cp.Fare <= 0 {
+			return nil, errors.Errorf("invalid fare %v of period %s-%s", cp.Fare, cp.Start, cp.End)
+		}
+
+		start, err := parseTimeOfDay(cp.Start)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing period start")
+		}
+
+		end, err := parseTimeOfDay(cp.End)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing period end")
+		}
+
+		t.Periods = append(t.Periods, Period{
+			End:   end,
+			Fare:  cp.Fare,
+			Start: start,
+		})
+	}
+
+	return t, nil
+}
+
+// LoadFile returns the table of the JSON config at path, see Load, or the
+// default table when path is empty.
+func LoadFile(path string) (*Table, error) {
+	if path == "" {
+		return Default(), nil
+	}
+
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "opening config")
+	}
+
+	defer f.Close()
+
+	return Load(f)
+}
+
+// parseTimeOfDay parses a HH:MM time of day.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
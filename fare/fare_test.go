@@ -0,0 +1,153 @@
+package fare_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nerdify/tuc/fare"
+)
+
+// managua is UTC-6 all year.
+var managua = time.FixedZone("CST", -6*60*60)
+
+func TestFare(t *testing.T) {
+	table := &fare.Table{
+		Default:  2.5,
+		Location: managua,
+		Periods: []fare.Period{
+			{Start: 22 * time.Hour, End: 5 * time.Hour, Fare: 3},
+			{Start: 12 * time.Hour, End: 13 * time.Hour, Fare: 4},
+		},
+		Routes: map[string]float64{
+			"110": 5,
+		},
+	}
+
+	local := func(hour, min int) time.Time {
+		return time.Date(2018, 5, 1, hour, min, 0, 0, managua)
+	}
+
+	tests := map[string]struct {
+		route string
+		at    time.Time
+		want  float64
+	}{
+		"default":                  {"", local(10, 0), 2.5},
+		"unknown route":            {"999", local(10, 0), 2.5},
+		"route":                    {"110", local(10, 0), 5},
+		"route over period":        {"110", local(23, 0), 5},
+		"period":                   {"", local(12, 30), 4},
+		"period end is exclusive":  {"", local(13, 0), 2.5},
+		"before midnight":          {"", local(22, 0), 3},
+		"after midnight":           {"", local(2, 0), 3},
+		"midnight period end":      {"", local(5, 0), 2.5},
+		"time zone, in period":     {"", time.Date(2018, 5, 2, 4, 0, 0, 0, time.UTC), 3},
+		"time zone, out of period": {"", time.Date(2018, 5, 1, 23, 0, 0, 0, time.UTC), 2.5},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := table.Fare(tt.route, tt.at); got != tt.want {
+				t.Fatalf("Fare(%q, %v) = %v, want %v", tt.route, tt.at, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("no location is UTC", func(t *testing.T) {
+		table := &fare.Table{
+			Default: 2.5,
+			Periods: []fare.Period{
+				{Start: 22 * time.Hour, End: 5 * time.Hour, Fare: 3},
+			},
+		}
+
+		if got := table.Fare("", time.Date(2018, 5, 1, 23, 0, 0, 0, time.UTC)); got != 3 {
+			t.Fatalf("Fare = %v, want 3", got)
+		}
+	})
+}
+
+func TestTripsRemaining(t *testing.T) {
+	tests := []struct {
+		balance, fare float64
+		want          int
+	}{
+		{10, 2.5, 4},
+		{9.99, 2.5, 3},
+		{2.5, 2.5, 1},
+		{2.49, 2.5, 0},
+		{0.3, 0.1, 3},
+		{0.1 + 0.2, 0.1, 3},
+		{0, 2.5, 0},
+		{-5, 2.5, 0},
+		{10, 0, 0},
+		{10, -2.5, 0},
+	}
+
+	for _, tt := range tests {
+		if got := fare.TripsRemaining(tt.balance, tt.fare); got != tt.want {
+			t.Errorf("TripsRemaining(%v, %v) = %d, want %d", tt.balance, tt.fare, got, tt.want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		table, err := fare.Load(strings.NewReader(`{
+			"default": 3,
+			"timezone": "America/Managua",
+			"routes": { "110": 5 },
+			"periods": [{ "start": "22:00", "end": "05:30", "fare": 4 }]
+		}`))
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+
+		if table.Default != 3 || table.Location.String() != "America/Managua" {
+			t.Fatalf("Load = %+v", table)
+		}
+
+		if want := map[string]float64{"110": 5}; !reflect.DeepEqual(table.Routes, want) {
+			t.Fatalf("Routes = %v, want %v", table.Routes, want)
+		}
+
+		want := []fare.Period{{Start: 22 * time.Hour, End: 5*time.Hour + 30*time.Minute, Fare: 4}}
+
+		if !reflect.DeepEqual(table.Periods, want) {
+			t.Fatalf("Periods = %+v, want %+v", table.Periods, want)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		table, err := fare.Load(strings.NewReader(`{}`))
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+
+		if !reflect.DeepEqual(table, fare.Default()) {
+			t.Fatalf("Load = %+v, want %+v", table, fare.Default())
+		}
+	})
+
+	invalid := map[string]string{
+		"malformed":            `{`,
+		"negative default":     `{"default": -1}`,
+		"zero route fare":      `{"routes": {"110": 0}}`,
+		"negative route fare":  `{"routes": {"110": -5}}`,
+		"zero period fare":     `{"periods": [{"start": "22:00", "end": "05:00", "fare": 0}]}`,
+		"negative period fare": `{"periods": [{"start": "22:00", "end": "05:00", "fare": -3}]}`,
+		"unknown timezone":     `{"timezone": "Nowhere/Else"}`,
+		"bad period start":     `{"periods": [{"start": "25:00", "end": "05:00", "fare": 3}]}`,
+		"bad period end":       `{"periods": [{"start": "22:00", "end": "5pm", "fare": 3}]}`,
+	}
+
+	for name, config := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if table, err := fare.Load(strings.NewReader(config)); err == nil {
+				t.Fatalf("Load = %+v, want an error", table)
+			}
+		})
+	}
+}
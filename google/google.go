@@ -0,0 +1,264 @@
+// Package google verifies Google ID tokens.
+package google
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc"
+)
+
+// CertsURL is the JWKS of the keys Google signs ID tokens with.
+const CertsURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+// Issuers of Google ID tokens.
+var Issuers = []string{"accounts.google.com", "https://accounts.google.com"}
+
+// ErrInvalidToken is returned when an ID token fails verification.
+var ErrInvalidToken = tuc.ErrInvalidIdentityToken
+
+// defaultMaxAge is how long keys are cached when Google does not say.
+const defaultMaxAge = time.Hour
+
+// minRefresh is the least time between fetches of the keys when a token is
+// signed with an unknown key.
+const minRefresh = time.Minute
+
+// Claims are the claims of a Google ID token.
+type Claims struct {
+	jwt.StandardClaims
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// Verifier verifies Google ID tokens issued to any of its audiences.
+type Verifier struct {
+	// Audience are the OAuth client ids of the app.
+	Audience []string
+
+	// CertsURL overrides the JWKS url, for example in tests.
+	CertsURL string
+
+	HTTPClient *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	expires   time.Time
+	fetchedAt time.Time
+}
+
+var _ tuc.IdentityProvider = &Verifier{}
+
+// NewVerifier returns a new instance of Verifier.
+func NewVerifier(audience ...string) *Verifier {
+	return &Verifier{
+		Audience:   audience,
+		CertsURL:   CertsURL,
+		HTTPClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Name returns "google".
+func (v *Verifier) Name() string {
+	return "google"
+}
+
+// Verify verifies an ID token, returning the identity of its subject.
+func (v *Verifier) Verify(ctx context.Context, idToken string) (*tuc.Identity, error) {
+	claims, err := v.VerifyClaims(ctx, idToken)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &tuc.Identity{
+		Email:   claims.Email,
+		Subject: claims.Subject,
+	}, nil
+}
+
+// VerifyClaims checks the signature, audience, issuer and expiry of an ID
+// token and that its email was verified, returning its claims.
+func (v *Verifier) VerifyClaims(ctx context.Context, idToken string) (*Claims, error) {
+	var claims Claims
+
+	_, err := jwt.ParseWithClaims(idToken, &claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, ErrInvalidToken
+		}
+
+		kid, _ := t.Header["kid"].(string)
+
+		return v.key(ctx, kid)
+	})
+
+	// failing to fetch the keys says nothing about the token
+	if e, ok := err.(*jwt.ValidationError); ok && e.Errors&jwt.ValidationErrorUnverifiable != 0 && errors.Cause(e.Inner) != ErrInvalidToken {
+		return nil, e.Inner
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidToken, err.Error())
+	}
+
+	// jwt-go only checks the expiry when there is one
+	if claims.ExpiresAt == 0 {
+		return nil, errors.Wrap(ErrInvalidToken, "missing expiry")
+	}
+
+	if !v.validAudience(claims.Audience) {
+		return nil, errors.Wrap(ErrInvalidToken, "audience mismatch")
+	}
+
+	if !validIssuer(claims.Issuer) {
+		return nil, errors.Wrap(ErrInvalidToken, "issuer mismatch")
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errors.Wrap(ErrInvalidToken, "email not verified")
+	}
+
+	return &claims, nil
+}
+
+func (v *Verifier) validAudience(aud string) bool {
+	for _, a := range v.Audience {
+		if a != "" && a == aud {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validIssuer(iss string) bool {
+	for _, i := range Issuers {
+		if i == iss {
+			return true
+		}
+	}
+
+	return false
+}
+
+// key returns the public key with the given id, fetching the keys when they
+// expired or the id is unknown.
+func (v *Verifier) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := time.Now()
+
+	if k, ok := v.keys[kid]; ok && now.Before(v.expires) {
+		return k, nil
+	}
+
+	if now.Before(v.expires) && now.Sub(v.fetchedAt) < minRefresh {
+		return nil, errors.Wrap(ErrInvalidToken, "unknown key")
+	}
+
+	if err := v.fetch(ctx); err != nil {
+		return nil, err
+	}
+
+	if k, ok := v.keys[kid]; ok {
+		return k, nil
+	}
+
+	return nil, errors.Wrap(ErrInvalidToken, "unknown key")
+}
+
+// jwks is a JSON Web Key Set.
+type jwks struct {
+	Keys []struct {
+		E   string `json:"e"`
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	} `json:"keys"`
+}
+
+// fetch fetches the keys.
+func (v *Verifier) fetch(ctx context.Context) error {
+	req, err := http.NewRequest(http.MethodGet, v.CertsURL, nil)
+
+	if err != nil {
+		return errors.Wrap(err, "creating request")
+	}
+
+	res, err := v.HTTPClient.Do(req.WithContext(ctx))
+
+	if err != nil {
+		return errors.Wrap(err, "requesting keys")
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("requesting keys: status %d", res.StatusCode)
+	}
+
+	var set jwks
+
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return errors.Wrap(err, "parsing keys")
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+
+		if err != nil {
+			return errors.Wrapf(err, "decoding modulus of key %s", k.Kid)
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+
+		if err != nil {
+			return errors.Wrapf(err, "decoding exponent of key %s", k.Kid)
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			E: int(new(big.Int).SetBytes(e).Int64()),
+			N: new(big.Int).SetBytes(n),
+		}
+	}
+
+	now := time.Now()
+	v.keys = keys
+	v.fetchedAt = now
+	v.expires = now.Add(maxAge(res.Header.Get("Cache-Control")))
+
+	return nil
+}
+
+var maxAgeRe = regexp.MustCompile(`max-age=(\d+)`)
+
+// maxAge returns the max-age of a Cache-Control header.
+func maxAge(header string) time.Duration {
+	m := maxAgeRe.FindStringSubmatch(header)
+
+	if m == nil {
+		return defaultMaxAge
+	}
+
+	s, _ := strconv.Atoi(m[1])
+
+	return time.Duration(s) * time.Second
+}
@@ -0,0 +1,172 @@
+package google_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc/google"
+)
+
+const audience = "client.apps.googleusercontent.com"
+
+// newKey returns a new RSA key, failing the test on error.
+func newKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	return k
+}
+
+// newCerts serves the public keys as a JWKS.
+func newCerts(t *testing.T, keys map[string]*rsa.PrivateKey) *httptest.Server {
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+
+	for kid, k := range keys {
+		set.Keys = append(set.Keys, map[string]string{
+			"alg": "RS256",
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+			"kid": kid,
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			"use": "sig",
+		})
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		json.NewEncoder(w).Encode(set)
+	}))
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func newVerifier(certs *httptest.Server) *google.Verifier {
+	v := google.NewVerifier(audience)
+	v.CertsURL = certs.URL
+
+	return v
+}
+
+func validClaims() *google.Claims {
+	return &google.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Audience:  audience,
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Issuer:    "https://accounts.google.com",
+			Subject:   "1234567890",
+		},
+		Email:         "a@b.c",
+		EmailVerified: true,
+	}
+}
+
+func sign(t *testing.T, key *rsa.PrivateKey, kid string, claims *google.Claims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+
+	return s
+}
+
+func TestVerify(t *testing.T) {
+	key, other := newKey(t), newKey(t)
+	v := newVerifier(newCerts(t, map[string]*rsa.PrivateKey{"k1": key}))
+
+	t.Run("valid", func(t *testing.T) {
+		identity, err := v.Verify(context.Background(), sign(t, key, "k1", validClaims()))
+		if err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+
+		if identity.Email != "a@b.c" || identity.Subject != "1234567890" {
+			t.Fatalf("Verify = %+v", identity)
+		}
+	})
+
+	invalid := map[string]func() string{
+		"wrong signature": func() string {
+			return sign(t, other, "k1", validClaims())
+		},
+		"unknown key": func() string {
+			return sign(t, key, "k2", validClaims())
+		},
+		"wrong audience": func() string {
+			c := validClaims()
+			c.Audience = "other.apps.googleusercontent.com"
+			return sign(t, key, "k1", c)
+		},
+		"wrong issuer": func() string {
+			c := validClaims()
+			c.Issuer = "https://evil.example.com"
+			return sign(t, key, "k1", c)
+		},
+		"expired": func() string {
+			c := validClaims()
+			c.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+			return sign(t, key, "k1", c)
+		},
+		"missing exp": func() string {
+			c := validClaims()
+			c.ExpiresAt = 0
+			return sign(t, key, "k1", c)
+		},
+		"email not verified": func() string {
+			c := validClaims()
+			c.EmailVerified = false
+			return sign(t, key, "k1", c)
+		},
+		"hmac": func() string {
+			s, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims()).SignedString([]byte("secret"))
+			return s
+		},
+		"malformed": func() string {
+			return "not a token"
+		},
+	}
+
+	for name, token := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := v.Verify(context.Background(), token())
+			if errors.Cause(err) != google.ErrInvalidToken {
+				t.Fatalf("Verify = %v, want %v", err, google.ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestVerifyCertsUnavailable(t *testing.T) {
+	key := newKey(t)
+	certs := httptest.NewServer(http.NotFoundHandler())
+	defer certs.Close()
+
+	_, err := newVerifier(certs).Verify(context.Background(), sign(t, key, "k1", validClaims()))
+	if err == nil || errors.Cause(err) == google.ErrInvalidToken {
+		t.Fatalf("Verify = %v, want an error fetching keys", err)
+	}
+}
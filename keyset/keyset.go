@@ -0,0 +1,255 @@
+// Package keyset signs and verifies tokens with a set of rotating keys.
+package keyset
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// Key is a key tokens are signed and verified with.
+type Key struct {
+	// ID is the kid of the tokens signed with the key. Tokens without a kid,
+	// signed before keys had ids, are verified with the key without one.
+	ID string
+
+	Method jwt.SigningMethod
+
+	// SignKey is a []byte for HMAC, an *rsa.PrivateKey or an
+	// ed25519.PrivateKey. It is nil for keys that only verify.
+	SignKey interface{}
+
+	// VerifyKey is a []byte for HMAC, an *rsa.PublicKey or an
+	// ed25519.PublicKey.
+	VerifyKey interface{}
+}
+
+// NewHMAC returns a new HS256 key.
+func NewHMAC(id string, secret []byte) *Key {
+	return &Key{
+		ID:        id,
+		Method:    jwt.SigningMethodHS256,
+		SignKey:   secret,
+		VerifyKey: secret,
+	}
+}
+
+// NewKey returns a new key for an algorithm: a secret for HS256, HS384 and
+// HS512, or a PEM encoded private or public key for RS256 and EdDSA.
+func NewKey(id, alg, key string) (*Key, error) {
+	switch alg {
+	case "HS256", "HS384", "HS512":
+		if key == "" {
+			return nil, errors.New("empty secret")
+		}
+
+		return &Key{
+			ID:        id,
+			Method:    jwt.GetSigningMethod(alg),
+			SignKey:   []byte(key),
+			VerifyKey: []byte(key),
+		}, nil
+	case "RS256", "EdDSA":
+		k, err := parsePEM(key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		k.ID = id
+		k.Method = jwt.GetSigningMethod(alg)
+
+		if _, ok := k.VerifyKey.(*rsa.PublicKey); ok != (alg == "RS256") {
+			return nil, errors.Errorf("not a %s key", alg)
+		}
+
+		return k, nil
+	default:
+		return nil, errors.Errorf("unsupported algorithm %q", alg)
+	}
+}
+
+// parsePEM parses a PEM encoded private or public key.
+func parsePEM(s string) (*Key, error) {
+	block, _ := pem.Decode([]byte(s))
+
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing public key")
+		}
+
+		switch pub := pub.(type) {
+		case *rsa.PublicKey, ed25519.PublicKey:
+			return &Key{VerifyKey: pub}, nil
+		}
+	case "PRIVATE KEY":
+		priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing private key")
+		}
+
+		switch priv := priv.(type) {
+		case *rsa.PrivateKey:
+			return &Key{SignKey: priv, VerifyKey: &priv.PublicKey}, nil
+		case ed25519.PrivateKey:
+			return &Key{SignKey: priv, VerifyKey: priv.Public()}, nil
+		}
+	case "RSA PRIVATE KEY":
+		priv, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing private key")
+		}
+
+		return &Key{SignKey: priv, VerifyKey: &priv.PublicKey}, nil
+	}
+
+	return nil, errors.Errorf("unsupported key type %s", block.Type)
+}
+
+// Keyset signs tokens with its first key, and verifies them with any of its
+// keys. Rotating a key is adding the new one first and keeping the old one
+// until the tokens it signed expire.
+type Keyset struct {
+	Keys []*Key
+}
+
+// Parse parses a keyset from a JSON array of keys with kid, alg and key
+// fields, as taken by NewKey.
+func Parse(data []byte) (*Keyset, error) {
+	var config []struct {
+		Alg string `json:"alg"`
+		ID  string `json:"kid"`
+		Key string `json:"key"`
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, errors.Wrap(err, "parsing keys")
+	}
+
+	s := &Keyset{}
+	ids := make(map[string]bool)
+
+	for _, c := range config {
+		if ids[c.ID] {
+			return nil, errors.Errorf("duplicate key %q", c.ID)
+		}
+
+		k, err := NewKey(c.ID, c.Alg, c.Key)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "key %q", c.ID)
+		}
+
+		ids[c.ID] = true
+		s.Keys = append(s.Keys, k)
+	}
+
+	if len(s.Keys) == 0 || s.Keys[0].SignKey == nil {
+		return nil, errors.New("the first key must be able to sign")
+	}
+
+	return s, nil
+}
+
+// Sign signs claims with the current key.
+func (s *Keyset) Sign(claims jwt.Claims) (string, error) {
+	if len(s.Keys) == 0 || s.Keys[0].SignKey == nil {
+		return "", errors.New("no signing key")
+	}
+
+	k := s.Keys[0]
+	token := jwt.NewWithClaims(k.Method, claims)
+
+	if k.ID != "" {
+		token.Header["kid"] = k.ID
+	}
+
+	return token.SignedString(k.SignKey)
+}
+
+// VerificationKey returns the key a token is verified with, as a
+// jwt.Keyfunc. The token must use the algorithm of its key, so a public key
+// is never taken as an HMAC secret.
+func (s *Keyset) VerificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	for _, k := range s.Keys {
+		if k.ID != kid {
+			continue
+		}
+
+		if token.Method.Alg() != k.Method.Alg() {
+			return nil, errors.Errorf("key %q is not %s", kid, token.Method.Alg())
+		}
+
+		return k.VerifyKey, nil
+	}
+
+	return nil, errors.Errorf("unknown key %q", kid)
+}
+
+// JWK is a public JSON Web Key.
+type JWK struct {
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	E   string `json:"e,omitempty"`
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n,omitempty"`
+	Use string `json:"use"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys, so others can verify tokens. HMAC keys are
+// secret and left out.
+func (s *Keyset) JWKS() *JWKS {
+	set := &JWKS{
+		Keys: []JWK{},
+	}
+
+	for _, k := range s.Keys {
+		jwk := JWK{
+			Alg: k.Method.Alg(),
+			Kid: k.ID,
+			Use: "sig",
+		}
+
+		switch pub := k.VerifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
@@ -0,0 +1,170 @@
+package keyset_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/nerdify/tuc/keyset"
+)
+
+// privatePEM returns a PEM encoded PKCS8 private key.
+func privatePEM(t *testing.T, key interface{}) string {
+	t.Helper()
+
+	b, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshaling key: %v", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b}))
+}
+
+// publicPEM returns a PEM encoded public key.
+func publicPEM(t *testing.T, key interface{}) string {
+	t.Helper()
+
+	b, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("marshaling key: %v", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}))
+}
+
+func parse(t *testing.T, keys ...map[string]string) *keyset.Keyset {
+	t.Helper()
+
+	b, _ := json.Marshal(keys)
+
+	s, err := keyset.Parse(b)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	return s
+}
+
+func claims() jwt.Claims {
+	return &jwt.StandardClaims{
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		Id:        "a@b.c",
+	}
+}
+
+func verify(s *keyset.Keyset, token string) error {
+	_, err := jwt.Parse(token, s.VerificationKey)
+	return err
+}
+
+func TestRotation(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	legacy := map[string]string{"kid": "", "alg": "HS256", "key": "secret"}
+	rs := map[string]string{"kid": "rs", "alg": "RS256", "key": privatePEM(t, rsaKey)}
+	ed := map[string]string{"kid": "ed", "alg": "EdDSA", "key": privatePEM(t, edKey)}
+
+	var tokens []string
+
+	for _, s := range []*keyset.Keyset{parse(t, legacy), parse(t, rs, legacy), parse(t, ed, rs, legacy)} {
+		token, err := s.Sign(claims())
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	current := parse(t, ed, rs, legacy)
+
+	for i, token := range tokens {
+		if err := verify(current, token); err != nil {
+			t.Fatalf("verifying token %d: %v", i, err)
+		}
+	}
+
+	// dropping a key stops verifying its tokens
+	if err := verify(parse(t, ed, rs), tokens[0]); err == nil {
+		t.Fatal("verified a token of a dropped key")
+	}
+
+	// previous keys only need their public part
+	rsPublic := map[string]string{"kid": "rs", "alg": "RS256", "key": publicPEM(t, &rsaKey.PublicKey)}
+
+	if err := verify(parse(t, ed, rsPublic), tokens[1]); err != nil {
+		t.Fatalf("verifying with a public key: %v", err)
+	}
+}
+
+func TestVerificationKeyAlgorithm(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	pub := publicPEM(t, &rsaKey.PublicKey)
+	s := parse(t, map[string]string{"kid": "rs", "alg": "RS256", "key": privatePEM(t, rsaKey)})
+
+	// an HMAC signed with the public key must not pass as the RSA key
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+	token.Header["kid"] = "rs"
+
+	forged, _ := token.SignedString([]byte(pub))
+
+	if err := verify(s, forged); err == nil {
+		t.Fatal("verified a token signed with the public key as a secret")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	invalid := map[string][]map[string]string{
+		"empty":          nil,
+		"empty secret":   {{"kid": "a", "alg": "HS256", "key": ""}},
+		"unknown alg":    {{"kid": "a", "alg": "none", "key": "secret"}},
+		"duplicate kid":  {{"kid": "a", "alg": "HS256", "key": "x"}, {"kid": "a", "alg": "HS256", "key": "y"}},
+		"wrong key type": {{"kid": "a", "alg": "RS256", "key": privatePEM(t, edKey)}},
+		"public first":   {{"kid": "a", "alg": "EdDSA", "key": publicPEM(t, edKey.Public())}},
+		"not PEM":        {{"kid": "a", "alg": "EdDSA", "key": "secret"}},
+	}
+
+	for name, keys := range invalid {
+		t.Run(name, func(t *testing.T) {
+			b, _ := json.Marshal(keys)
+
+			if _, err := keyset.Parse(b); err == nil {
+				t.Fatal("Parse succeeded")
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	s := parse(t,
+		map[string]string{"kid": "ed", "alg": "EdDSA", "key": privatePEM(t, edKey)},
+		map[string]string{"kid": "", "alg": "HS256", "key": "secret"},
+	)
+
+	set := s.JWKS()
+
+	if len(set.Keys) != 1 {
+		t.Fatalf("JWKS = %+v, want only the public key", set)
+	}
+
+	if k := set.Keys[0]; k.Kid != "ed" || k.Kty != "OKP" || k.Crv != "Ed25519" || k.X == "" {
+		t.Fatalf("JWKS = %+v", set)
+	}
+}
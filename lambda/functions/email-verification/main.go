@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"html/template"
+	"net/url"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -19,19 +20,76 @@ var (
 	tmp    = template.Must(template.ParseFiles("template.html"))
 )
 
-func sendEmail(email, token string) {
-	url := fmt.Sprintf("https://saldotuc.com/api/authenticate?email=%s&token=%s", email, token)
+// message is an email with a link to follow.
+type message struct {
+	Button  string
+	Subject string
+	Text    string
+	Title   string
+	URL     string
+}
+
+func link(path string, query url.Values) string {
+	return "https://saldotuc.com/api/" + path + "?" + query.Encode()
+}
+
+func sendEmail(ctx context.Context, email, token string) {
+	send(ctx, email, &message{
+		Button:  "Verificar",
+		Subject: "Verificación de inicio de sesión - Saldo TUC",
+		Text:    "Para completar el proceso de inicio de sesión, haga clic en el siguiente botón:",
+		Title:   "Verifique su correo electrónico",
+		URL:     link("authenticate", url.Values{"email": {email}, "token": {token}}),
+	})
+}
+
+// sendEmailChange sends the confirm link of an email change to the new email,
+// and the cancel link to the old one.
+func sendEmailChange(ctx context.Context, item map[string]events.DynamoDBAttributeValue) {
+	userID := item["u_id"].String()
+
+	send(ctx, item["new_email"].String(), &message{
+		Button:  "Confirmar",
+		Subject: "Confirmación de cambio de correo electrónico - Saldo TUC",
+		Text:    "Para usar esta dirección en su cuenta de Saldo TUC, haga clic en el siguiente botón:",
+		Title:   "Confirme su nuevo correo electrónico",
+		URL:     link("email/confirm", url.Values{"token": {item["confirm_token"].String()}, "user": {userID}}),
+	})
+
+	if old := item["old_email"].String(); old != "" {
+		send(ctx, old, &message{
+			Button:  "Cancelar",
+			Subject: "Cambio de correo electrónico - Saldo TUC",
+			Text:    fmt.Sprintf("Se solicitó cambiar el correo electrónico de su cuenta a %s. Si no fue usted, haga clic en el siguiente botón para cancelar el cambio y cerrar todas las sesiones:", item["new_email"].String()),
+			Title:   "Cambio de correo electrónico",
+			URL:     link("email/cancel", url.Values{"token": {item["cancel_token"].String()}, "user": {userID}}),
+		})
+	}
+}
 
+// sendInvite tells an email a card was shared with it, which is seen once
+// logging in with it.
+func sendInvite(ctx context.Context, email string) {
+	send(ctx, email, &message{
+		Button:  "Iniciar sesión",
+		Subject: "Tarjeta compartida - Saldo TUC",
+		Text:    "Se compartió con usted una tarjeta en Saldo TUC. Para verla, inicie sesión con este correo electrónico:",
+		Title:   "Le compartieron una tarjeta",
+		URL:     "https://saldotuc.com",
+	})
+}
+
+func send(ctx context.Context, to string, m *message) {
 	var buf bytes.Buffer
 
-	if err := tmp.Execute(&buf, url); err != nil {
+	if err := tmp.Execute(&buf, m); err != nil {
 		fmt.Println(err.Error())
 		return
 	}
 
 	input := &ses.SendEmailInput{
 		Destination: &ses.Destination{
-			ToAddresses: []string{email},
+			ToAddresses: []string{to},
 		},
 		Message: &ses.Message{
 			Body: &ses.Body{
@@ -42,13 +100,14 @@ func sendEmail(email, token string) {
 			},
 			Subject: &ses.Content{
 				Charset: aws.String("UTF-8"),
-				Data:    aws.String("Verificación de inicio de sesión - Saldo TUC"),
+				Data:    aws.String(m.Subject),
 			},
 		},
 		Source: aws.String("signin@saldotuc.com"),
 	}
 
 	req := svc.SendEmailRequest(input)
+	req.SetContext(ctx)
 	_, err := req.Send()
 
 	if err != nil {
@@ -56,6 +115,8 @@ func sendEmail(email, token string) {
 	}
 }
 
+// handler sends the emails of the login requests, email changes and card
+// invites streams.
 func handler(ctx context.Context, e events.DynamoDBEvent) {
 	for _, record := range e.Records {
 		if record.EventName == "REMOVE" {
@@ -64,14 +125,32 @@ func handler(ctx context.Context, e events.DynamoDBEvent) {
 
 		item := record.Change.NewImage
 
+		// invites are only modified by sharing the card again
+		if _, ok := item["card_id"]; ok {
+			if record.EventName == "INSERT" {
+				sendInvite(ctx, item["email"].String())
+			}
+
+			continue
+		}
+
+		// email changes are only modified by confirming them
+		if _, ok := item["new_email"]; ok {
+			if !item["confirmed"].Boolean() {
+				sendEmailChange(ctx, item)
+			}
+
+			continue
+		}
+
 		if item["verified"].Boolean() {
 			continue
 		}
 
-		email := item["u_id"].String()
+		email := item["email"].String()
 		token := item["verification_token"].String()
 
-		sendEmail(email, token)
+		sendEmail(ctx, email, token)
 	}
 }
 
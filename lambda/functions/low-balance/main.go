@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/aws/external"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go-v2/service/ses"
+
+	"github.com/nerdify/tuc"
+)
+
+var (
+	cfg, _     = external.LoadDefaultAWSConfig()
+	db         = dynamodb.New(cfg)
+	svc        = ses.New(cfg)
+	cardsTable = os.Getenv("CARDS_TABLE")
+	usersTable = os.Getenv("USERS_TABLE")
+)
+
+// alertEmail is the alert email in a language.
+type alertEmail struct {
+	// Subject is formatted with the name of the card.
+	Subject  string
+	Template *template.Template
+}
+
+// alertEmails are the alert emails by language.
+var alertEmails = map[string]*alertEmail{
+	"en": {
+		Subject:  "Low balance on %s - Saldo TUC",
+		Template: template.Must(template.ParseFiles("template.en.html")),
+	},
+	"es": {
+		Subject:  "Saldo bajo en %s - Saldo TUC",
+		Template: template.Must(template.ParseFiles("template.html")),
+	},
+}
+
+// emailFor returns the alert email in a language, or else in spanish.
+func emailFor(language string) *alertEmail {
+	if e, ok := alertEmails[language]; ok {
+		return e
+	}
+
+	return alertEmails[tuc.DefaultNotificationPreferences.Language]
+}
+
+// card is the part of a card item needed for alerts.
+type card struct {
+	Alerted     bool
+	Balance     float64
+	ID          string
+	Name        string
+	NotifyEmail *bool
+	Number      string
+	Threshold   float64
+	UserID      string
+}
+
+// parseCard reads a card from a stream image.
+func parseCard(item map[string]events.DynamoDBAttributeValue) (*card, error) {
+	c := &card{
+		ID:     item["id"].String(),
+		UserID: item["u_id"].String(),
+	}
+
+	if v, ok := item["name"]; ok {
+		c.Name = v.String()
+	}
+
+	if v, ok := item["number"]; ok {
+		c.Number = v.String()
+	}
+
+	if v, ok := item["low_balance_alerted"]; ok {
+		c.Alerted = v.Boolean()
+	}
+
+	if v, ok := item["notify_email"]; ok {
+		notify := v.Boolean()
+		c.NotifyEmail = &notify
+	}
+
+	var err error
+
+	if v, ok := item["balance"]; ok {
+		if c.Balance, err = v.Float(); err != nil {
+			return nil, err
+		}
+	}
+
+	if v, ok := item["low_balance_threshold"]; ok {
+		if c.Threshold, err = v.Float(); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// action is what a change of a card calls for.
+type action int
+
+const (
+	none action = iota
+
+	// alert sends an alert, once per drop under the threshold.
+	alert
+
+	// reset allows the next drop to alert again, once recharged over the
+	// threshold.
+	reset
+)
+
+// decide returns the action a card calls for.
+func decide(c *card) action {
+	switch {
+	case c.Threshold <= 0:
+		return none
+	case c.Balance < c.Threshold && !c.Alerted:
+		return alert
+	case c.Balance > c.Threshold && c.Alerted:
+		return reset
+	default:
+		return none
+	}
+}
+
+// recipient returns the owner of the card when they want email alerts for
+// it, from the card setting or else their preferences, or else nil.
+func recipient(ctx context.Context, c *card) (*tuc.User, error) {
+	if c.NotifyEmail != nil && !*c.NotifyEmail {
+		return nil, nil
+	}
+
+	input := &dynamodb.GetItemInput{
+		Key: map[string]dynamodb.AttributeValue{
+			"id": {
+				S: &c.UserID,
+			},
+		},
+		TableName: &usersTable,
+	}
+
+	req := db.GetItemRequest(input)
+	req.SetContext(ctx)
+	res, err := req.Send()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var u tuc.User
+
+	if err := dynamodbattribute.UnmarshalMap(res.Item, &u); err != nil {
+		return nil, err
+	}
+
+	if u.Email == "" || c.NotifyEmail == nil && !u.Preferences().Email {
+		return nil, nil
+	}
+
+	return &u, nil
+}
+
+// setAlerted flags whether an alert was sent for the card, returning false
+// when the flag already had that value.
+func setAlerted(ctx context.Context, c *card, alerted bool) (bool, error) {
+	input := &dynamodb.UpdateItemInput{
+		ConditionExpression: aws.String("attribute_exists(id) AND (attribute_not_exists(#a) OR #a <> :a)"),
+		ExpressionAttributeNames: map[string]string{
+			"#a": "low_balance_alerted",
+		},
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":a": {
+				BOOL: aws.Bool(alerted),
+			},
+		},
+		Key: map[string]dynamodb.AttributeValue{
+			"id": {
+				S: &c.ID,
+			},
+			"u_id": {
+				S: &c.UserID,
+			},
+		},
+		TableName:        &cardsTable,
+		UpdateExpression: aws.String("SET #a = :a"),
+	}
+
+	req := db.UpdateItemRequest(input)
+	req.SetContext(ctx)
+	_, err := req.Send()
+
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case dynamodb.ErrCodeConditionalCheckFailedException:
+			return false, nil
+		}
+	}
+
+	return err == nil, err
+}
+
+func sendEmail(ctx context.Context, c *card, u *tuc.User) {
+	var buf bytes.Buffer
+
+	m := emailFor(u.Preferences().Language)
+
+	if err := m.Template.Execute(&buf, c); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	input := &ses.SendEmailInput{
+		Destination: &ses.Destination{
+			ToAddresses: []string{u.Email},
+		},
+		Message: &ses.Message{
+			Body: &ses.Body{
+				Html: &ses.Content{
+					Charset: aws.String("UTF-8"),
+					Data:    aws.String(buf.String()),
+				},
+			},
+			Subject: &ses.Content{
+				Charset: aws.String("UTF-8"),
+				Data:    aws.String(fmt.Sprintf(m.Subject, c.Name)),
+			},
+		},
+		Source: aws.String("alertas@saldotuc.com"),
+	}
+
+	req := svc.SendEmailRequest(input)
+	req.SetContext(ctx)
+	_, err := req.Send()
+
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+}
+
+func handler(ctx context.Context, e events.DynamoDBEvent) {
+	for _, record := range e.Records {
+		if record.EventName == "REMOVE" {
+			continue
+		}
+
+		c, err := parseCard(record.Change.NewImage)
+
+		if err != nil {
+			fmt.Println(err.Error())
+			continue
+		}
+
+		switch decide(c) {
+		case alert:
+			u, err := recipient(ctx, c)
+
+			if err != nil || u == nil {
+				if err != nil {
+					fmt.Println(err.Error())
+				}
+
+				continue
+			}
+
+			// the flag is set first so concurrent records send one email
+			ok, err := setAlerted(ctx, c, true)
+
+			if err != nil {
+				fmt.Println(err.Error())
+				continue
+			}
+
+			if ok {
+				sendEmail(ctx, c, u)
+			}
+		case reset:
+			// recharged, so the next drop alerts again
+			if _, err := setAlerted(ctx, c, false); err != nil {
+				fmt.Println(err.Error())
+			}
+		}
+	}
+}
+
+func main() {
+	lambda.Start(handler)
+}
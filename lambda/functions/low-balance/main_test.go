@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDecide(t *testing.T) {
+	tests := map[string]struct {
+		card card
+		want action
+	}{
+		"disabled":         {card{Balance: 5, Threshold: 0}, none},
+		"over":             {card{Balance: 30, Threshold: 20}, none},
+		"under":            {card{Balance: 10, Threshold: 20}, alert},
+		"at the threshold": {card{Balance: 20, Threshold: 20}, none},
+		"already alerted":  {card{Alerted: true, Balance: 10, Threshold: 20}, none},
+		"recharged":        {card{Alerted: true, Balance: 30, Threshold: 20}, reset},
+		"recharged to it":  {card{Alerted: true, Balance: 20, Threshold: 20}, none},
+		"under by a cent":  {card{Balance: 19.99, Threshold: 20}, alert},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := decide(&tt.card); got != tt.want {
+				t.Fatalf("decide(%+v) = %v, want %v", tt.card, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmailFor(t *testing.T) {
+	c := &card{Balance: 10, Name: "Trabajo", Number: "12345678", Threshold: 20}
+
+	tests := map[string]struct {
+		subject string
+		text    string
+	}{
+		"es": {"Saldo bajo en Trabajo - Saldo TUC", "Su tarjeta tiene saldo bajo"},
+		"en": {"Low balance on Trabajo - Saldo TUC", "Your card has a low balance"},
+		"":   {"Saldo bajo en Trabajo - Saldo TUC", "Su tarjeta tiene saldo bajo"},
+		"fr": {"Saldo bajo en Trabajo - Saldo TUC", "Su tarjeta tiene saldo bajo"},
+	}
+
+	for language, tt := range tests {
+		t.Run(language, func(t *testing.T) {
+			m := emailFor(language)
+
+			if got := fmt.Sprintf(m.Subject, c.Name); got != tt.subject {
+				t.Fatalf("Subject = %q, want %q", got, tt.subject)
+			}
+
+			var buf bytes.Buffer
+
+			if err := m.Template.Execute(&buf, c); err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+
+			if body := buf.String(); !strings.Contains(body, tt.text) || !strings.Contains(body, "C$10.00") {
+				t.Fatalf("body = %s, want %q and the balance", body, tt.text)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc"
+	"github.com/nerdify/tuc/client"
+	"github.com/nerdify/tuc/dynamodb"
+	"github.com/nerdify/tuc/events"
+	"github.com/nerdify/tuc/fare"
+	"github.com/nerdify/tuc/refresh"
+)
+
+// margin is left before the Lambda deadline to save the cursor and report
+// the stats.
+const margin = 5 * time.Second
+
+// cursorName is the name the cursor of the refresh is saved under.
+const cursorName = "refresh"
+
+// Handle refreshes the cards from where the last run stopped, stopping
+// shortly before the Lambda times out. A run that visits the last card makes
+// the next one start over.
+func Handle(ctx context.Context) (*refresh.Stats, error) {
+	db, err := dynamodb.NewClient(dynamodb.Config{
+		Tables: dynamodb.Tables{
+			BalanceHistory: os.Getenv("BALANCE_HISTORY_TABLE"),
+			CardEvents:     os.Getenv("CARD_EVENTS_TABLE"),
+			Cards:          os.Getenv("CARDS_TABLE"),
+			Cursors:        os.Getenv("CURSORS_TABLE"),
+		},
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "creating dynamodb client")
+	}
+
+	cursors := dynamodb.NewCursorService(db)
+	cursor, err := cursors.Get(ctx, cursorName)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "loading cursor")
+	}
+
+	// the same fares as the api, see function.json
+	fares, err := fare.LoadFile(os.Getenv("FARES_CONFIG"))
+
+	if err != nil {
+		return nil, errors.Wrap(err, "loading fares config")
+	}
+
+	cards := dynamodb.NewCardService(db)
+
+	r := &refresh.Refresher{
+		CardService: cards,
+		Client:      client.NewClient(os.Getenv("ENDPOINT")),
+		Recorder: &events.Recorder{
+			BalanceHistoryService: dynamodb.NewBalanceHistoryService(db),
+			CardEventService:      dynamodb.NewCardEventService(db),
+			CardService:           cards,
+			Detector: &events.Detector{
+				Fares: fares,
+			},
+		},
+	}
+
+	r.Cursor = cursor
+	stats, err := run(ctx, r)
+
+	if err == context.DeadlineExceeded {
+		log.Warn("timed out before visiting every card")
+		err = nil
+	}
+
+	if perr := cursors.Put(ctx, cursorName, stats.Cursor); perr != nil {
+		log.WithError(perr).Error("saving cursor")
+	}
+
+	return stats, err
+}
+
+// run runs r until shortly before the deadline of ctx, starting over when
+// its cursor is no longer valid.
+func run(ctx context.Context, r *refresh.Refresher) (*refresh.Stats, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-margin))
+		defer cancel()
+	}
+
+	stats, err := r.Run(ctx)
+
+	if errors.Cause(err) == tuc.ErrInvalidCursor {
+		log.WithField("cursor", r.Cursor).Warn("invalid cursor, starting over")
+		r.Cursor = ""
+		return r.Run(ctx)
+	}
+
+	return stats, err
+}
+
+func main() {
+	lambda.Start(Handle)
+}
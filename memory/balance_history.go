@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nerdify/tuc"
+)
+
+// BalanceHistoryService represents an in-memory implementation of tuc.BalanceHistoryService.
+type BalanceHistoryService struct {
+	mu        sync.RWMutex
+	snapshots map[string][]tuc.BalanceSnapshot
+}
+
+var _ tuc.BalanceHistoryService = &BalanceHistoryService{}
+
+// Append a snapshot.
+func (s *BalanceHistoryService) Append(ctx context.Context, snapshot *tuc.BalanceSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.snapshots == nil {
+		s.snapshots = make(map[string][]tuc.BalanceSnapshot)
+	}
+
+	// snapshots are kept sorted, replacing one taken at the same time
+	list := s.snapshots[snapshot.CardID]
+	i, found := search(len(list), func(i int) time.Time { return list[i].Time }, snapshot.Time)
+
+	if !found {
+		list = append(list, tuc.BalanceSnapshot{})
+		copy(list[i+1:], list[i:])
+	}
+
+	list[i] = *snapshot
+	s.snapshots[snapshot.CardID] = list
+
+	return nil
+}
+
+// List snapshots of a card.
+func (s *BalanceHistoryService) List(ctx context.Context, cardID string, from, to time.Time, limit int, cursor string) ([]tuc.BalanceSnapshot, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := s.snapshots[cardID]
+	start, end, next, err := page(len(list), func(i int) time.Time { return list[i].Time }, from, to, limit, cursor)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return append([]tuc.BalanceSnapshot{}, list[start:end]...), next, nil
+}
+
+// Delete snapshots of a card.
+func (s *BalanceHistoryService) Delete(ctx context.Context, cardID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.snapshots, cardID)
+
+	return nil
+}
@@ -0,0 +1,260 @@
+package memory
+
+import (
+	"context"
+	"encoding/base64"
+	"sort"
+	"sync"
+
+	"github.com/nerdify/tuc"
+)
+
+// CardService represents an in-memory implementation of tuc.CardService.
+type CardService struct {
+	mu      sync.RWMutex
+	cards   map[string]map[string]tuc.Card
+	members map[string]map[string]tuc.CardMember
+}
+
+var _ tuc.CardService = &CardService{}
+
+// List all Cards.
+func (s *CardService) List(ctx context.Context, userID string) ([]tuc.Card, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cards := []tuc.Card{}
+
+	for _, c := range s.cards[userID] {
+		c.Permission = tuc.CardPermissionOwner
+		cards = append(cards, c)
+	}
+
+	for _, m := range s.members {
+		if c, ok := s.shared(m[userID]); ok {
+			cards = append(cards, c)
+		}
+	}
+
+	sort.Slice(cards, func(i, j int) bool {
+		return cards[i].ID < cards[j].ID
+	})
+
+	return cards, nil
+}
+
+// Get individual card.
+func (s *CardService) Get(ctx context.Context, userID, cardID string) (*tuc.Card, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if c, ok := s.cards[userID][cardID]; ok {
+		c.Permission = tuc.CardPermissionOwner
+		return &c, nil
+	}
+
+	if c, ok := s.shared(s.members[cardID][userID]); ok {
+		return &c, nil
+	}
+
+	return nil, nil
+}
+
+// shared returns the card of a membership, if any.
+func (s *CardService) shared(m tuc.CardMember) (tuc.Card, bool) {
+	c, ok := s.cards[m.OwnerID][m.CardID]
+	c.Permission = m.Permission
+
+	return c, ok
+}
+
+// Create a new card.
+func (s *CardService) Create(ctx context.Context, card *tuc.Card) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.cards[card.UserID] {
+		if c.ID == card.ID || c.Number == card.Number {
+			return tuc.ErrCardExists
+		}
+	}
+
+	s.put(*card)
+
+	return nil
+}
+
+// Update a card.
+func (s *CardService) Update(ctx context.Context, userID, cardID string, prev, balance float64) (*tuc.Card, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.cards[userID][cardID]
+
+	if !ok {
+		return nil, nil
+	}
+
+	if c.Balance != prev {
+		return nil, tuc.ErrBalanceChanged
+	}
+
+	c.Balance = balance
+	s.put(c)
+
+	return &c, nil
+}
+
+// Patch a card.
+func (s *CardService) Patch(ctx context.Context, userID, cardID string, patch *tuc.CardPatch) (*tuc.Card, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.cards[userID][cardID]
+
+	if !ok {
+		return nil, nil
+	}
+
+	if patch.LowBalanceThreshold != nil {
+		c.LowBalanceThreshold = *patch.LowBalanceThreshold
+	}
+
+	if patch.Name != nil {
+		c.Name = *patch.Name
+	}
+
+	if patch.NotifyEmail != nil {
+		v := *patch.NotifyEmail
+		c.NotifyEmail = &v
+	}
+
+	if patch.NotifyPush != nil {
+		v := *patch.NotifyPush
+		c.NotifyPush = &v
+	}
+
+	s.put(c)
+
+	return &c, nil
+}
+
+// Delete card.
+func (s *CardService) Delete(ctx context.Context, userID, cardID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.cards[userID][cardID]; !ok {
+		return nil
+	}
+
+	delete(s.cards[userID], cardID)
+	delete(s.members, cardID)
+
+	return nil
+}
+
+// Share a card.
+func (s *CardService) Share(ctx context.Context, member *tuc.CardMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.members == nil {
+		s.members = make(map[string]map[string]tuc.CardMember)
+	}
+
+	if s.members[member.CardID] == nil {
+		s.members[member.CardID] = make(map[string]tuc.CardMember)
+	}
+
+	s.members[member.CardID][member.UserID] = *member
+
+	return nil
+}
+
+// Unshare a card.
+func (s *CardService) Unshare(ctx context.Context, cardID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.members[cardID], userID)
+
+	return nil
+}
+
+// Members of a card.
+func (s *CardService) Members(ctx context.Context, cardID string) ([]tuc.CardMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	members := []tuc.CardMember{}
+
+	for _, m := range s.members[cardID] {
+		members = append(members, m)
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].UserID < members[j].UserID
+	})
+
+	return members, nil
+}
+
+func (s *CardService) put(c tuc.Card) {
+	if s.cards == nil {
+		s.cards = make(map[string]map[string]tuc.Card)
+	}
+
+	if s.cards[c.UserID] == nil {
+		s.cards[c.UserID] = make(map[string]tuc.Card)
+	}
+
+	s.cards[c.UserID][c.ID] = c
+}
+
+// Scan all cards.
+func (s *CardService) Scan(ctx context.Context, limit int, cursor string) ([]tuc.Card, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cards := []tuc.Card{}
+
+	for _, m := range s.cards {
+		for _, c := range m {
+			cards = append(cards, c)
+		}
+	}
+
+	sort.Slice(cards, func(i, j int) bool {
+		return scanKey(cards[i]) < scanKey(cards[j])
+	})
+
+	start := 0
+
+	if cursor != "" {
+		b, err := base64.RawURLEncoding.DecodeString(cursor)
+
+		if err != nil {
+			return nil, "", tuc.ErrInvalidCursor
+		}
+
+		start = sort.Search(len(cards), func(i int) bool {
+			return scanKey(cards[i]) > string(b)
+		})
+	}
+
+	cards = cards[start:]
+
+	if limit <= 0 || len(cards) <= limit {
+		return cards, "", nil
+	}
+
+	cards = cards[:limit]
+
+	return cards, base64.RawURLEncoding.EncodeToString([]byte(scanKey(cards[limit-1]))), nil
+}
+
+// scanKey orders cards by user and id.
+func scanKey(c tuc.Card) string {
+	return c.UserID + "\x00" + c.ID
+}
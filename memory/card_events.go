@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nerdify/tuc"
+)
+
+// CardEventService represents an in-memory implementation of tuc.CardEventService.
+type CardEventService struct {
+	mu     sync.RWMutex
+	events map[string][]tuc.CardEvent
+}
+
+var _ tuc.CardEventService = &CardEventService{}
+
+// Create a new event.
+func (s *CardEventService) Create(ctx context.Context, event *tuc.CardEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.events == nil {
+		s.events = make(map[string][]tuc.CardEvent)
+	}
+
+	// events are kept sorted, replacing one at the same time
+	list := s.events[event.CardID]
+	i, found := search(len(list), func(i int) time.Time { return list[i].Time }, event.Time)
+
+	if !found {
+		list = append(list, tuc.CardEvent{})
+		copy(list[i+1:], list[i:])
+	}
+
+	list[i] = *event
+	s.events[event.CardID] = list
+
+	return nil
+}
+
+// List events of a card.
+func (s *CardEventService) List(ctx context.Context, cardID string, from, to time.Time, limit int, cursor string) ([]tuc.CardEvent, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := s.events[cardID]
+	start, end, next, err := page(len(list), func(i int) time.Time { return list[i].Time }, from, to, limit, cursor)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return append([]tuc.CardEvent{}, list[start:end]...), next, nil
+}
+
+// Delete events of a card.
+func (s *CardEventService) Delete(ctx context.Context, cardID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.events, cardID)
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/nerdify/tuc"
+)
+
+// CardInviteService represents an in-memory implementation of
+// tuc.CardInviteService.
+type CardInviteService struct {
+	mu      sync.RWMutex
+	invites map[string]map[string]tuc.CardInvite
+}
+
+var _ tuc.CardInviteService = &CardInviteService{}
+
+// Create an invite.
+func (s *CardInviteService) Create(ctx context.Context, invite *tuc.CardInvite) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.invites == nil {
+		s.invites = make(map[string]map[string]tuc.CardInvite)
+	}
+
+	if s.invites[invite.CardID] == nil {
+		s.invites[invite.CardID] = make(map[string]tuc.CardInvite)
+	}
+
+	s.invites[invite.CardID][invite.Email] = *invite
+
+	return nil
+}
+
+// Delete an invite.
+func (s *CardInviteService) Delete(ctx context.Context, cardID, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.invites[cardID], email)
+
+	return nil
+}
+
+// List the invites to a card.
+func (s *CardInviteService) List(ctx context.Context, cardID string) ([]tuc.CardInvite, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invites := []tuc.CardInvite{}
+
+	for _, i := range s.invites[cardID] {
+		invites = append(invites, i)
+	}
+
+	sort.Slice(invites, func(i, j int) bool {
+		return invites[i].Email < invites[j].Email
+	})
+
+	return invites, nil
+}
+
+// ListByEmail lists the invites for an email.
+func (s *CardInviteService) ListByEmail(ctx context.Context, email string) ([]tuc.CardInvite, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invites := []tuc.CardInvite{}
+
+	for _, m := range s.invites {
+		if i, ok := m[email]; ok {
+			invites = append(invites, i)
+		}
+	}
+
+	sort.Slice(invites, func(i, j int) bool {
+		return invites[i].CardID < invites[j].CardID
+	})
+
+	return invites, nil
+}
@@ -0,0 +1,44 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nerdify/tuc"
+)
+
+// CursorService represents an in-memory implementation of
+// tuc.CursorService.
+type CursorService struct {
+	mu      sync.Mutex
+	cursors map[string]string
+}
+
+var _ tuc.CursorService = &CursorService{}
+
+// Get returns the cursor saved under name.
+func (s *CursorService) Get(ctx context.Context, name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.cursors[name], nil
+}
+
+// Put saves a cursor under name.
+func (s *CursorService) Put(ctx context.Context, name, cursor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cursors == nil {
+		s.cursors = make(map[string]string)
+	}
+
+	if cursor == "" {
+		delete(s.cursors, name)
+		return nil
+	}
+
+	s.cursors[name] = cursor
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nerdify/tuc"
+)
+
+// EmailChangeService represents an in-memory implementation of
+// tuc.EmailChangeService.
+type EmailChangeService struct {
+	mu      sync.Mutex
+	changes map[string]tuc.EmailChange
+}
+
+var _ tuc.EmailChangeService = &EmailChangeService{}
+
+// Create an email change.
+func (s *EmailChangeService) Create(ctx context.Context, change *tuc.EmailChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.changes == nil {
+		s.changes = make(map[string]tuc.EmailChange)
+	}
+
+	if c, ok := s.changes[change.UserID]; ok && c.Confirmed && time.Now().Before(c.ExpiresAt) {
+		return tuc.ErrEmailChangePending
+	}
+
+	s.changes[change.UserID] = *change
+
+	return nil
+}
+
+// Confirm an email change.
+func (s *EmailChangeService) Confirm(ctx context.Context, userID, token string, expiresAt time.Time) (*tuc.EmailChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.changes[userID]
+
+	if !ok || c.ConfirmToken != token || c.Confirmed || !time.Now().Before(c.ExpiresAt) {
+		return nil, tuc.ErrInvalidEmailChange
+	}
+
+	c.Confirmed = true
+	c.ExpiresAt = expiresAt
+	s.changes[userID] = c
+
+	return &c, nil
+}
+
+// Cancel an email change.
+func (s *EmailChangeService) Cancel(ctx context.Context, userID, token string) (*tuc.EmailChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.changes[userID]
+
+	if !ok || c.CancelToken != token || !time.Now().Before(c.ExpiresAt) {
+		return nil, tuc.ErrInvalidEmailChange
+	}
+
+	delete(s.changes, userID)
+
+	return &c, nil
+}
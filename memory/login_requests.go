@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nerdify/tuc"
+)
+
+// LoginRequestService represents an in-memory implementation of tuc.LoginRequestService.
+type LoginRequestService struct {
+	mu       sync.Mutex
+	requests map[string]tuc.LoginRequest
+}
+
+var _ tuc.LoginRequestService = &LoginRequestService{}
+
+// Create a new login request.
+func (s *LoginRequestService) Create(ctx context.Context, request *tuc.LoginRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.requests == nil {
+		s.requests = make(map[string]tuc.LoginRequest)
+	}
+
+	s.requests[request.UserID] = *request
+
+	return nil
+}
+
+// Delete a login request.
+func (s *LoginRequestService) Delete(ctx context.Context, userID, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.requests[userID]
+
+	if !ok || r.RequestToken != code || !r.Verified {
+		return tuc.ErrInvalidLoginRequest
+	}
+
+	delete(s.requests, userID)
+
+	return nil
+}
+
+// Verify a login request.
+func (s *LoginRequestService) Verify(ctx context.Context, userID, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.requests[userID]
+
+	if !ok || r.VerificationToken != token || r.Verified {
+		return tuc.ErrInvalidLoginRequest
+	}
+
+	r.Verified = true
+	s.requests[userID] = r
+
+	return nil
+}
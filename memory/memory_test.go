@@ -0,0 +1,48 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/nerdify/tuc/memory"
+	"github.com/nerdify/tuc/servicetest"
+)
+
+func TestCardService(t *testing.T) {
+	servicetest.TestCardService(t, &memory.CardService{})
+}
+
+func TestCardInviteService(t *testing.T) {
+	servicetest.TestCardInviteService(t, &memory.CardInviteService{})
+}
+
+func TestUserService(t *testing.T) {
+	servicetest.TestUserService(t, &memory.UserService{})
+}
+
+func TestLoginRequestService(t *testing.T) {
+	servicetest.TestLoginRequestService(t, &memory.LoginRequestService{})
+}
+
+func TestBalanceHistoryService(t *testing.T) {
+	servicetest.TestBalanceHistoryService(t, &memory.BalanceHistoryService{})
+}
+
+func TestCardEventService(t *testing.T) {
+	servicetest.TestCardEventService(t, &memory.CardEventService{})
+}
+
+func TestRefreshTokenService(t *testing.T) {
+	servicetest.TestRefreshTokenService(t, &memory.RefreshTokenService{})
+}
+
+func TestRevocationService(t *testing.T) {
+	servicetest.TestRevocationService(t, &memory.RevocationService{})
+}
+
+func TestCursorService(t *testing.T) {
+	servicetest.TestCursorService(t, &memory.CursorService{})
+}
+
+func TestEmailChangeService(t *testing.T) {
+	servicetest.TestEmailChangeService(t, &memory.EmailChangeService{})
+}
@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nerdify/tuc"
+)
+
+// RefreshTokenService represents an in-memory implementation of
+// tuc.RefreshTokenService.
+type RefreshTokenService struct {
+	mu     sync.Mutex
+	tokens map[string]tuc.RefreshToken
+}
+
+var _ tuc.RefreshTokenService = &RefreshTokenService{}
+
+// Create a refresh token family.
+func (s *RefreshTokenService) Create(ctx context.Context, token *tuc.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tokens == nil {
+		s.tokens = make(map[string]tuc.RefreshToken)
+	}
+
+	s.tokens[token.FamilyID] = *token
+
+	return nil
+}
+
+// Rotate a refresh token.
+func (s *RefreshTokenService) Rotate(ctx context.Context, familyID, hash, next string, expiresAt time.Time) (*tuc.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[familyID]
+
+	if !ok || t.Revoked || !time.Now().Before(t.ExpiresAt) {
+		return nil, tuc.ErrInvalidRefreshToken
+	}
+
+	if t.Hash != hash {
+		t.Revoked = true
+		s.tokens[familyID] = t
+		return nil, tuc.ErrRefreshTokenReused
+	}
+
+	t.ExpiresAt = expiresAt
+	t.Hash = next
+	s.tokens[familyID] = t
+
+	return &t, nil
+}
+
+// Revoke a refresh token family.
+func (s *RefreshTokenService) Revoke(ctx context.Context, familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.tokens[familyID]; ok {
+		t.Revoked = true
+		s.tokens[familyID] = t
+	}
+
+	return nil
+}
+
+// RevokeUser revokes the refresh token families of a user.
+func (s *RefreshTokenService) RevokeUser(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, t := range s.tokens {
+		if t.UserID == userID {
+			t.Revoked = true
+			s.tokens[id] = t
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nerdify/tuc"
+)
+
+// RevocationService represents an in-memory implementation of
+// tuc.RevocationService.
+type RevocationService struct {
+	mu          sync.Mutex
+	revocations map[string]tuc.Revocation
+}
+
+var _ tuc.RevocationService = &RevocationService{}
+
+// Find the revocation of a user.
+func (s *RevocationService) Find(ctx context.Context, userID string) (*tuc.Revocation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.revocations[userID]
+
+	if !ok || !time.Now().Before(r.ExpiresAt) {
+		return nil, nil
+	}
+
+	r.Sessions = append([]string(nil), r.Sessions...)
+
+	return &r, nil
+}
+
+// RevokeSession revokes the tokens of a session.
+func (s *RevocationService) RevokeSession(ctx context.Context, userID, sessionID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.get(userID)
+	r.ExpiresAt = expiresAt
+	r.Sessions = append(append([]string(nil), r.Sessions...), sessionID)
+	s.revocations[userID] = r
+
+	return nil
+}
+
+// RevokeAll revokes the tokens of a user.
+func (s *RevocationService) RevokeAll(ctx context.Context, userID string, before, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.get(userID)
+	r.ExpiresAt = expiresAt
+	r.NotBefore = before.Truncate(time.Second)
+	s.revocations[userID] = r
+
+	return nil
+}
+
+// get returns the revocation of a user, starting a new one when it expired
+// like the dynamodb TTL would.
+func (s *RevocationService) get(userID string) tuc.Revocation {
+	if s.revocations == nil {
+		s.revocations = make(map[string]tuc.Revocation)
+	}
+
+	r, ok := s.revocations[userID]
+
+	if !ok || !time.Now().Before(r.ExpiresAt) {
+		r = tuc.Revocation{
+			UserID: userID,
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/nerdify/tuc"
+)
+
+// search returns the index at which t keeps a list of n items sorted by time
+// at, and whether an item at t already exists.
+func search(n int, at func(int) time.Time, t time.Time) (int, bool) {
+	i := sort.Search(n, func(i int) bool {
+		return !at(i).Before(t)
+	})
+
+	return i, i < n && at(i).Equal(t)
+}
+
+// page returns the bounds of the page of a list of n items sorted by time at,
+// with the same range and pagination semantics as the dynamodb time range
+// queries, and the cursor of the next page.
+func page(n int, at func(int) time.Time, from, to time.Time, limit int, cursor string) (int, int, string, error) {
+	start := sort.Search(n, func(i int) bool {
+		return !at(i).Before(from)
+	})
+
+	if cursor != "" {
+		ts, err := strconv.ParseInt(cursor, 10, 64)
+
+		if err != nil {
+			return 0, 0, "", tuc.ErrInvalidCursor
+		}
+
+		after := sort.Search(n, func(i int) bool {
+			return at(i).UnixNano() > ts
+		})
+
+		if after > start {
+			start = after
+		}
+	}
+
+	end := n
+
+	if !to.IsZero() {
+		end = sort.Search(n, func(i int) bool {
+			return at(i).After(to)
+		})
+	}
+
+	if end < start {
+		end = start
+	}
+
+	if limit > 0 && end-start > limit {
+		end = start + limit
+		return start, end, strconv.FormatInt(at(end-1).UnixNano(), 10), nil
+	}
+
+	return start, end, "", nil
+}
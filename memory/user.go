@@ -0,0 +1,195 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nerdify/tuc"
+)
+
+// UserService represents an in-memory implementation of tuc.UserService.
+type UserService struct {
+	mu         sync.RWMutex
+	users      map[string]tuc.User
+	emails     map[string]string
+	identities map[string]string
+}
+
+var _ tuc.UserService = &UserService{}
+
+// Find returns the User with the specified id.
+func (s *UserService) Find(ctx context.Context, id string) (*tuc.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+
+	if !ok {
+		return nil, nil
+	}
+
+	return &u, nil
+}
+
+// FindByEmail returns the User with the specified email.
+func (s *UserService) FindByEmail(ctx context.Context, email string) (*tuc.User, error) {
+	s.mu.RLock()
+	id, ok := s.emails[email]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, nil
+	}
+
+	return s.Find(ctx, id)
+}
+
+// FindByIdentity returns the User linked to the subject of a provider.
+func (s *UserService) FindByIdentity(ctx context.Context, provider, subject string) (*tuc.User, error) {
+	s.mu.RLock()
+	id, ok := s.identities[identityKey(provider, subject)]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, nil
+	}
+
+	return s.Find(ctx, id)
+}
+
+// Create creates a new user.
+func (s *UserService) Create(ctx context.Context, user *tuc.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id, ok := s.emails[user.Email]; ok && id != user.ID {
+		return tuc.ErrEmailTaken
+	}
+
+	for provider, subject := range user.Identities {
+		if id, ok := s.identities[identityKey(provider, subject)]; ok && id != user.ID {
+			return tuc.ErrIdentityTaken
+		}
+	}
+
+	u := *user
+
+	// keep the caller from changing the stored identities
+	if user.Identities != nil {
+		u.Identities = make(map[string]string)
+
+		for provider, subject := range user.Identities {
+			u.Identities[provider] = subject
+		}
+	}
+
+	s.put(u)
+
+	return nil
+}
+
+// ChangeEmail changes the email of an user.
+func (s *UserService) ChangeEmail(ctx context.Context, id, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if other, ok := s.emails[email]; ok && other != id {
+		return tuc.ErrEmailTaken
+	}
+
+	u, ok := s.users[id]
+
+	if !ok {
+		u = tuc.User{
+			ID: id,
+		}
+	}
+
+	if u.Email != "" {
+		delete(s.emails, u.Email)
+	}
+
+	u.Email = email
+	s.put(u)
+
+	return nil
+}
+
+// Link an identity to an user.
+func (s *UserService) Link(ctx context.Context, id, provider, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if other, ok := s.identities[identityKey(provider, subject)]; ok && other != id {
+		return tuc.ErrIdentityTaken
+	}
+
+	u, ok := s.users[id]
+
+	if !ok {
+		u = tuc.User{
+			ID: id,
+		}
+	}
+
+	if old := u.Identities[provider]; old != "" {
+		delete(s.identities, identityKey(provider, old))
+	}
+
+	identities := map[string]string{
+		provider: subject,
+	}
+
+	for p, subject := range u.Identities {
+		if p != provider {
+			identities[p] = subject
+		}
+	}
+
+	u.Identities = identities
+	s.put(u)
+
+	return nil
+}
+
+// UpdateNotifications sets the notification preferences of an user.
+func (s *UserService) UpdateNotifications(ctx context.Context, id string, prefs *tuc.NotificationPreferences) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+
+	if !ok {
+		u = tuc.User{
+			ID: id,
+		}
+	}
+
+	p := *prefs
+	u.Notifications = &p
+	s.put(u)
+
+	return nil
+}
+
+func (s *UserService) put(u tuc.User) {
+	if s.users == nil {
+		s.users = make(map[string]tuc.User)
+		s.emails = make(map[string]string)
+		s.identities = make(map[string]string)
+	}
+
+	s.users[u.ID] = u
+
+	if u.Email != "" {
+		s.emails[u.Email] = u.ID
+	}
+
+	for provider, subject := range u.Identities {
+		s.identities[identityKey(provider, subject)] = u.ID
+	}
+}
+
+func identityKey(provider, subject string) string {
+	return provider + "#" + subject
+}
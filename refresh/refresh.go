@@ -0,0 +1,239 @@
+// Package refresh keeps the balance of every card current without waiting
+// for its owner to open the app.
+package refresh
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc"
+	"github.com/nerdify/tuc/client"
+	"github.com/nerdify/tuc/events"
+)
+
+// Defaults for a Refresher.
+const (
+	DefaultConcurrency = 4
+	DefaultInterval    = 200 * time.Millisecond
+	DefaultPageSize    = 100
+)
+
+// minBackoff is the least a worker waits for the circuit breaker, since it
+// stays closed to other requests while a trial request is in flight.
+const minBackoff = time.Second
+
+// Stats is the outcome of a refresh.
+type Stats struct {
+	Cards   int `json:"cards"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+	Failed  int `json:"failed"`
+
+	// Cursor is where a refresh cut short resumes, empty when every card was
+	// visited.
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// Refresher refreshes the balance of every card.
+type Refresher struct {
+	CardService tuc.CardService
+	Client      *client.Client
+	Recorder    *events.Recorder
+
+	// Concurrency is the number of cards refreshed at once.
+	Concurrency int
+
+	// Cursor is the cursor of the CardService scan to start after, empty to
+	// start from the first card.
+	Cursor string
+
+	// Interval is the minimum time between requests to the upstream.
+	Interval time.Duration
+
+	// PageSize is the number of cards read from storage at once.
+	PageSize int
+}
+
+// Run refreshes every card after Cursor, returning when all of them were
+// visited or ctx is done. Upstream failures are counted rather than returned;
+// when the circuit breaker of the client opens, workers wait for it before
+// going on.
+//
+// Every page of cards is refreshed before the next one is read, so a refresh
+// cut short resumes from the page it stopped in.
+func (r *Refresher) Run(ctx context.Context) (*Stats, error) {
+	size := r.PageSize
+
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+
+	interval := r.Interval
+
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var stats Stats
+
+	cursor := r.Cursor
+
+	for {
+		page, next, err := r.CardService.Scan(ctx, size, cursor)
+
+		if err != nil {
+			stats.Cursor = cursor
+			return &stats, errors.Wrap(err, "scanning cards")
+		}
+
+		r.refreshPage(ctx, ticker.C, page, &stats)
+
+		if err := ctx.Err(); err != nil {
+			stats.Cursor = cursor
+			return &stats, err
+		}
+
+		if next == "" {
+			return &stats, nil
+		}
+
+		cursor = next
+	}
+}
+
+// refreshPage refreshes a page of cards, adding up the results to stats.
+func (r *Refresher) refreshPage(ctx context.Context, tick <-chan time.Time, page []tuc.Card, stats *Stats) {
+	concurrency := r.Concurrency
+
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	cards := make(chan tuc.Card)
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for c := range cards {
+				res := r.refresh(ctx, tick, &c)
+
+				mu.Lock()
+				switch res {
+				case updated:
+					stats.Updated++
+				case skipped:
+					stats.Skipped++
+				case failed:
+					stats.Failed++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, c := range page {
+		if ctx.Err() != nil {
+			break
+		}
+
+		mu.Lock()
+		stats.Cards++
+		mu.Unlock()
+
+		cards <- c
+	}
+
+	close(cards)
+	wg.Wait()
+}
+
+type result int
+
+const (
+	updated result = iota
+	skipped
+	failed
+)
+
+// refresh refreshes a single card, waiting for tick before every request.
+func (r *Refresher) refresh(ctx context.Context, tick <-chan time.Time, card *tuc.Card) result {
+	l := log.WithField("card", card.ID)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return failed
+		case <-tick:
+		}
+
+		b, err := r.Client.Balance(ctx, card.Number)
+
+		switch errors.Cause(err) {
+		case nil:
+		case client.ErrCircuitOpen:
+			if !r.backoff(ctx) {
+				return failed
+			}
+
+			continue
+		case client.ErrCardNotFound, client.ErrCardBlocked:
+			l.WithError(err).Info("skipping card")
+			return skipped
+		default:
+			l.WithError(err).Warn("getting balance")
+			return failed
+		}
+
+		c, err := r.Recorder.Record(ctx, card, b.Balance)
+
+		if err != nil {
+			l.WithError(err).Error("recording balance")
+			return failed
+		}
+
+		// deleted since it was scanned
+		if c == nil {
+			l.Info("skipping deleted card")
+			return skipped
+		}
+
+		return updated
+	}
+}
+
+// backoff waits until the circuit breaker of the client lets requests
+// through again, reporting false when ctx is done first.
+func (r *Refresher) backoff(ctx context.Context) bool {
+	wait := r.Client.Breaker.RetryAfter()
+
+	if wait < minBackoff {
+		wait = minBackoff
+	}
+
+	log.WithField("wait", wait).Warn("upstream unavailable, backing off")
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,338 @@
+package refresh_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/discard"
+	"github.com/pkg/errors"
+
+	"github.com/nerdify/tuc"
+	"github.com/nerdify/tuc/client"
+	"github.com/nerdify/tuc/client/fake"
+	"github.com/nerdify/tuc/events"
+	"github.com/nerdify/tuc/fare"
+	"github.com/nerdify/tuc/memory"
+	"github.com/nerdify/tuc/refresh"
+)
+
+func init() {
+	log.SetHandler(discard.Default)
+}
+
+// inFlight counts the concurrent requests to a handler.
+type inFlight struct {
+	http.Handler
+	n, max int32
+}
+
+func (h *inFlight) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := atomic.AddInt32(&h.n, 1)
+	defer atomic.AddInt32(&h.n, -1)
+
+	for {
+		max := atomic.LoadInt32(&h.max)
+
+		if n <= max || atomic.CompareAndSwapInt32(&h.max, max, n) {
+			break
+		}
+	}
+
+	h.Handler.ServeHTTP(w, r)
+}
+
+// deletingCards deletes the cards it scans, as if deleted right after.
+type deletingCards struct {
+	*memory.CardService
+}
+
+func (s deletingCards) Scan(ctx context.Context, limit int, cursor string) ([]tuc.Card, string, error) {
+	page, next, err := s.CardService.Scan(ctx, limit, cursor)
+
+	for _, c := range page {
+		s.Delete(ctx, c.UserID, c.ID)
+	}
+
+	return page, next, err
+}
+
+// failingScan fails to scan after a number of pages.
+type failingScan struct {
+	*memory.CardService
+	pages int
+}
+
+func (s *failingScan) Scan(ctx context.Context, limit int, cursor string) ([]tuc.Card, string, error) {
+	if s.pages == 0 {
+		return nil, "", errors.New("unavailable")
+	}
+
+	s.pages--
+
+	return s.CardService.Scan(ctx, limit, cursor)
+}
+
+// testRefresher is a refresher of n cards with a balance of 10, which the
+// upstream has at 5.
+type testRefresher struct {
+	*refresh.Refresher
+	cards    *memory.CardService
+	requests *inFlight
+	upstream *fake.Server
+	close    func()
+}
+
+func newTestRefresher(t *testing.T, n int) *testRefresher {
+	t.Helper()
+
+	upstream := fake.New()
+	requests := &inFlight{Handler: upstream}
+	s := httptest.NewServer(requests)
+
+	c := client.NewClient(s.URL)
+	c.MaxRetries = 0
+
+	cards := &memory.CardService{}
+
+	for i := 1; i <= n; i++ {
+		card := &tuc.Card{
+			Balance: 10,
+			ID:      fmt.Sprintf("%d", i),
+			Name:    "Card",
+			Number:  number(i),
+			UserID:  "a",
+		}
+
+		if err := cards.Create(context.Background(), card); err != nil {
+			t.Fatalf("creating card: %v", err)
+		}
+
+		upstream.SetCard(card.Number, fake.Card{Balance: 5, Status: "Activo"})
+	}
+
+	return &testRefresher{
+		Refresher: &refresh.Refresher{
+			CardService: cards,
+			Client:      c,
+			Interval:    time.Millisecond,
+			Recorder: &events.Recorder{
+				BalanceHistoryService: &memory.BalanceHistoryService{},
+				CardEventService:      &memory.CardEventService{},
+				CardService:           cards,
+				Detector: &events.Detector{
+					Fares: fare.Default(),
+				},
+			},
+		},
+		cards:    cards,
+		requests: requests,
+		upstream: upstream,
+		close:    s.Close,
+	}
+}
+
+// number returns the number of the i-th card.
+func number(i int) string {
+	return fmt.Sprintf("%08d", i)
+}
+
+// balance returns the stored balance of the i-th card.
+func (r *testRefresher) balance(t *testing.T, i int) float64 {
+	t.Helper()
+
+	c, err := r.cards.Get(context.Background(), "a", fmt.Sprintf("%d", i))
+	if err != nil || c == nil {
+		t.Fatalf("Get = %+v, %v", c, err)
+	}
+
+	return c.Balance
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("every card across pages", func(t *testing.T) {
+		r := newTestRefresher(t, 5)
+		defer r.close()
+
+		r.PageSize = 2
+
+		stats, err := r.Run(ctx)
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+
+		if want := (refresh.Stats{Cards: 5, Updated: 5}); *stats != want {
+			t.Fatalf("Run = %+v, want %+v", *stats, want)
+		}
+
+		for i := 1; i <= 5; i++ {
+			if b := r.balance(t, i); b != 5 {
+				t.Fatalf("card %d balance = %v, want 5", i, b)
+			}
+		}
+	})
+
+	t.Run("concurrency", func(t *testing.T) {
+		r := newTestRefresher(t, 8)
+		defer r.close()
+
+		r.Concurrency = 2
+		r.upstream.SetLatency(10 * time.Millisecond)
+
+		if _, err := r.Run(ctx); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+
+		if max := atomic.LoadInt32(&r.requests.max); max > 2 {
+			t.Fatalf("got %d concurrent requests, want at most 2", max)
+		}
+	})
+
+	t.Run("interval", func(t *testing.T) {
+		r := newTestRefresher(t, 5)
+		defer r.close()
+
+		r.Concurrency = 5
+		r.Interval = 20 * time.Millisecond
+
+		start := time.Now()
+
+		if _, err := r.Run(ctx); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+
+		// a request per tick
+		if d := time.Since(start); d < 5*r.Interval {
+			t.Fatalf("Run took %v, want at least %v", d, 5*r.Interval)
+		}
+	})
+
+	t.Run("skips unknown and blocked cards", func(t *testing.T) {
+		r := newTestRefresher(t, 3)
+		defer r.close()
+
+		r.upstream.RemoveCard(number(1))
+		r.upstream.SetCard(number(2), fake.Card{Balance: 5, Status: "Bloqueado"})
+
+		stats, err := r.Run(ctx)
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+
+		if want := (refresh.Stats{Cards: 3, Updated: 1, Skipped: 2}); *stats != want {
+			t.Fatalf("Run = %+v, want %+v", *stats, want)
+		}
+
+		if b := r.balance(t, 1); b != 10 {
+			t.Fatalf("skipped card balance = %v, want 10", b)
+		}
+	})
+
+	t.Run("skips deleted cards", func(t *testing.T) {
+		r := newTestRefresher(t, 2)
+		defer r.close()
+
+		r.CardService = deletingCards{r.cards}
+
+		stats, err := r.Run(ctx)
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+
+		if want := (refresh.Stats{Cards: 2, Skipped: 2}); *stats != want {
+			t.Fatalf("Run = %+v, want %+v", *stats, want)
+		}
+
+		if cards, _ := r.cards.List(ctx, "a"); len(cards) != 0 {
+			t.Fatalf("List = %+v, want no cards", cards)
+		}
+	})
+
+	t.Run("resumes from the cursor", func(t *testing.T) {
+		r := newTestRefresher(t, 5)
+		defer r.close()
+
+		r.PageSize = 2
+		r.CardService = &failingScan{CardService: r.cards, pages: 1}
+
+		stats, err := r.Run(ctx)
+		if err == nil {
+			t.Fatal("Run succeeded, want an error")
+		}
+
+		if stats.Cards != 2 || stats.Updated != 2 || stats.Cursor == "" {
+			t.Fatalf("Run = %+v, want 2 cards and a cursor", *stats)
+		}
+
+		r.CardService = r.cards
+		r.Cursor = stats.Cursor
+
+		stats, err = r.Run(ctx)
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+
+		if want := (refresh.Stats{Cards: 3, Updated: 3}); *stats != want {
+			t.Fatalf("Run = %+v, want %+v", *stats, want)
+		}
+
+		for i := 1; i <= 5; i++ {
+			if b := r.balance(t, i); b != 5 {
+				t.Fatalf("card %d balance = %v, want 5", i, b)
+			}
+		}
+	})
+
+	t.Run("stops when done", func(t *testing.T) {
+		r := newTestRefresher(t, 5)
+		defer r.close()
+
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		stats, err := r.Run(ctx)
+		if err != context.Canceled {
+			t.Fatalf("Run = %v, want %v", err, context.Canceled)
+		}
+
+		if stats.Cursor != r.Cursor || stats.Updated != 0 {
+			t.Fatalf("Run = %+v, want to resume from the start", *stats)
+		}
+	})
+
+	t.Run("backs off while the breaker is open", func(t *testing.T) {
+		r := newTestRefresher(t, 2)
+		defer r.close()
+
+		r.Concurrency = 1
+		r.Client.Breaker = client.NewBreaker(1, 10*time.Millisecond)
+		r.upstream.Script(number(1), fake.Step{Status: http.StatusInternalServerError})
+
+		start := time.Now()
+
+		stats, err := r.Run(ctx)
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+
+		if want := (refresh.Stats{Cards: 2, Updated: 1, Failed: 1}); *stats != want {
+			t.Fatalf("Run = %+v, want %+v", *stats, want)
+		}
+
+		// the second card waited for the breaker, at least a second
+		if d := time.Since(start); d < time.Second {
+			t.Fatalf("Run took %v, want a backoff of at least a second", d)
+		}
+
+		if b := r.balance(t, 2); b != 5 {
+			t.Fatalf("card 2 balance = %v, want 5", b)
+		}
+	})
+}
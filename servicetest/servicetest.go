@@ -0,0 +1,1724 @@
+// Package servicetest provides a conformance test suite for implementations
+// of the tuc service interfaces.
+//
+// Every test creates its own records with random identifiers, so the same
+// service may be shared between tests and backed by a persistent store.
+package servicetest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/nerdify/tuc"
+)
+
+// TestCardService tests that s behaves as a tuc.CardService.
+func TestCardService(t *testing.T, s tuc.CardService) {
+	ctx := context.Background()
+
+	t.Run("Get missing", func(t *testing.T) {
+		c, err := s.Get(ctx, newID(), newID())
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+
+		if c != nil {
+			t.Fatalf("Get = %+v, want nil", c)
+		}
+	})
+
+	t.Run("Create and Get", func(t *testing.T) {
+		want := newCard(newID())
+		mustCreateCard(t, s, want)
+
+		got, err := s.Get(ctx, want.UserID, want.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+
+		if got == nil || *got != owned(*want) {
+			t.Fatalf("Get = %+v, want %+v", got, owned(*want))
+		}
+	})
+
+	t.Run("Create duplicate", func(t *testing.T) {
+		c := newCard(newID())
+		mustCreateCard(t, s, c)
+
+		same := newCard(c.UserID)
+		same.Number = c.Number
+
+		if err := s.Create(ctx, same); err != tuc.ErrCardExists {
+			t.Fatalf("Create same number = %v, want %v", err, tuc.ErrCardExists)
+		}
+
+		same = newCard(c.UserID)
+		same.ID = c.ID
+
+		if err := s.Create(ctx, same); err != tuc.ErrCardExists {
+			t.Fatalf("Create same id = %v, want %v", err, tuc.ErrCardExists)
+		}
+
+		// the same number may be registered by another user
+		other := newCard(newID())
+		other.Number = c.Number
+		mustCreateCard(t, s, other)
+	})
+
+	t.Run("List scoped per user", func(t *testing.T) {
+		userID := newID()
+		a := newCard(userID)
+		b := newCard(userID)
+		mustCreateCard(t, s, a)
+		mustCreateCard(t, s, b)
+		mustCreateCard(t, s, newCard(newID()))
+
+		cards, err := s.List(ctx, userID)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+
+		if len(cards) != 2 {
+			t.Fatalf("List returned %d cards, want 2", len(cards))
+		}
+
+		for _, c := range cards {
+			if c != owned(*a) && c != owned(*b) {
+				t.Fatalf("List returned unexpected card %+v", c)
+			}
+		}
+	})
+
+	t.Run("List without cards", func(t *testing.T) {
+		cards, err := s.List(ctx, newID())
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+
+		if len(cards) != 0 {
+			t.Fatalf("List returned %d cards, want 0", len(cards))
+		}
+	})
+
+	t.Run("Update returns the new card", func(t *testing.T) {
+		c := newCard(newID())
+		mustCreateCard(t, s, c)
+
+		want := *c
+		want.Balance = 42.5
+
+		got, err := s.Update(ctx, c.UserID, c.ID, c.Balance, want.Balance)
+		if err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+
+		if got == nil || *got != want {
+			t.Fatalf("Update = %+v, want %+v", got, want)
+		}
+
+		stored, err := s.Get(ctx, c.UserID, c.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+
+		if stored == nil || *stored != owned(want) {
+			t.Fatalf("Get = %+v, want %+v", stored, owned(want))
+		}
+	})
+
+	t.Run("Update missing", func(t *testing.T) {
+		c := newCard(newID())
+
+		got, err := s.Update(ctx, c.UserID, c.ID, c.Balance, 42.5)
+		if err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+
+		if got != nil {
+			t.Fatalf("Update = %+v, want nil", got)
+		}
+
+		// the card is not created
+		cards, err := s.List(ctx, c.UserID)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+
+		if len(cards) != 0 {
+			t.Fatalf("List = %+v, want no cards", cards)
+		}
+	})
+
+	t.Run("Update changed balance", func(t *testing.T) {
+		c := newCard(newID())
+		mustCreateCard(t, s, c)
+
+		if _, err := s.Update(ctx, c.UserID, c.ID, c.Balance+1, 42.5); err != tuc.ErrBalanceChanged {
+			t.Fatalf("Update = %v, want ErrBalanceChanged", err)
+		}
+
+		stored, err := s.Get(ctx, c.UserID, c.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+
+		if stored == nil || *stored != owned(*c) {
+			t.Fatalf("Get = %+v, want %+v", stored, owned(*c))
+		}
+	})
+
+	t.Run("Patch", func(t *testing.T) {
+		c := newCard(newID())
+		mustCreateCard(t, s, c)
+
+		threshold, notify := 20.0, false
+		want := *c
+		want.LowBalanceThreshold = threshold
+		want.NotifyEmail = &notify
+
+		got, err := s.Patch(ctx, c.UserID, c.ID, &tuc.CardPatch{
+			LowBalanceThreshold: &threshold,
+			NotifyEmail:         &notify,
+		})
+		if err != nil {
+			t.Fatalf("Patch: %v", err)
+		}
+
+		if !reflect.DeepEqual(got, &want) {
+			t.Fatalf("Patch = %+v, want %+v", got, want)
+		}
+
+		// fields left out are unchanged
+		name, push := "Renamed", true
+		want.Name = name
+		want.NotifyPush = &push
+
+		got, err = s.Patch(ctx, c.UserID, c.ID, &tuc.CardPatch{
+			Name:       &name,
+			NotifyPush: &push,
+		})
+		if err != nil {
+			t.Fatalf("Patch: %v", err)
+		}
+
+		if !reflect.DeepEqual(got, &want) {
+			t.Fatalf("Patch = %+v, want %+v", got, want)
+		}
+
+		stored, err := s.Get(ctx, c.UserID, c.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+
+		if want := owned(want); !reflect.DeepEqual(stored, &want) {
+			t.Fatalf("Get = %+v, want %+v", stored, want)
+		}
+	})
+
+	t.Run("Patch missing", func(t *testing.T) {
+		threshold := 20.0
+
+		got, err := s.Patch(ctx, newID(), newID(), &tuc.CardPatch{
+			LowBalanceThreshold: &threshold,
+		})
+		if err != nil {
+			t.Fatalf("Patch: %v", err)
+		}
+
+		if got != nil {
+			t.Fatalf("Patch = %+v, want nil", got)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		c := newCard(newID())
+		mustCreateCard(t, s, c)
+
+		if err := s.Delete(ctx, c.UserID, c.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+
+		got, err := s.Get(ctx, c.UserID, c.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+
+		if got != nil {
+			t.Fatalf("Get = %+v after Delete, want nil", got)
+		}
+	})
+
+	t.Run("Delete missing", func(t *testing.T) {
+		if err := s.Delete(ctx, newID(), newID()); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+	})
+
+	t.Run("Share", func(t *testing.T) {
+		c := newCard(newID())
+		mustCreateCard(t, s, c)
+
+		member := &tuc.CardMember{
+			CardID:     c.ID,
+			OwnerID:    c.UserID,
+			Permission: tuc.CardPermissionRead,
+			UserID:     newID(),
+		}
+
+		if err := s.Share(ctx, member); err != nil {
+			t.Fatalf("Share: %v", err)
+		}
+
+		want := *c
+		want.Permission = tuc.CardPermissionRead
+
+		got, err := s.Get(ctx, member.UserID, c.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+
+		if got == nil || *got != want {
+			t.Fatalf("Get = %+v, want %+v", got, want)
+		}
+
+		cards, err := s.List(ctx, member.UserID)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+
+		if len(cards) != 1 || cards[0] != want {
+			t.Fatalf("List = %+v, want [%+v]", cards, want)
+		}
+
+		// sharing again replaces the permission
+		member.Permission = tuc.CardPermissionManage
+
+		if err := s.Share(ctx, member); err != nil {
+			t.Fatalf("Share: %v", err)
+		}
+
+		members, err := s.Members(ctx, c.ID)
+		if err != nil {
+			t.Fatalf("Members: %v", err)
+		}
+
+		if len(members) != 1 || members[0] != *member {
+			t.Fatalf("Members = %+v, want [%+v]", members, *member)
+		}
+
+		// the card is not visible to other users
+		got, err = s.Get(ctx, newID(), c.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+
+		if got != nil {
+			t.Fatalf("Get = %+v for a stranger, want nil", got)
+		}
+	})
+
+	t.Run("Unshare", func(t *testing.T) {
+		c := newCard(newID())
+		mustCreateCard(t, s, c)
+
+		member := &tuc.CardMember{
+			CardID:     c.ID,
+			OwnerID:    c.UserID,
+			Permission: tuc.CardPermissionRead,
+			UserID:     newID(),
+		}
+
+		if err := s.Share(ctx, member); err != nil {
+			t.Fatalf("Share: %v", err)
+		}
+
+		if err := s.Unshare(ctx, c.ID, member.UserID); err != nil {
+			t.Fatalf("Unshare: %v", err)
+		}
+
+		got, err := s.Get(ctx, member.UserID, c.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+
+		if got != nil {
+			t.Fatalf("Get = %+v after Unshare, want nil", got)
+		}
+	})
+
+	t.Run("Delete stops sharing", func(t *testing.T) {
+		c := newCard(newID())
+		mustCreateCard(t, s, c)
+
+		member := &tuc.CardMember{
+			CardID:     c.ID,
+			OwnerID:    c.UserID,
+			Permission: tuc.CardPermissionManage,
+			UserID:     newID(),
+		}
+
+		if err := s.Share(ctx, member); err != nil {
+			t.Fatalf("Share: %v", err)
+		}
+
+		// members cannot delete the card
+		if err := s.Delete(ctx, member.UserID, c.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+
+		if got, _ := s.Get(ctx, c.UserID, c.ID); got == nil {
+			t.Fatal("Get = nil after a member's Delete, want the card")
+		}
+
+		if err := s.Delete(ctx, c.UserID, c.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+
+		members, err := s.Members(ctx, c.ID)
+		if err != nil {
+			t.Fatalf("Members: %v", err)
+		}
+
+		if len(members) != 0 {
+			t.Fatalf("Members = %+v after Delete, want none", members)
+		}
+	})
+
+	t.Run("Scan visits every card once", func(t *testing.T) {
+		userID := newID()
+		want := map[string]bool{}
+
+		for _, c := range []*tuc.Card{newCard(userID), newCard(userID), newCard(newID())} {
+			mustCreateCard(t, s, c)
+			want[c.ID] = true
+		}
+
+		seen := map[string]int{}
+		cursor := ""
+
+		for {
+			cards, next, err := s.Scan(ctx, 2, cursor)
+			if err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+
+			for _, c := range cards {
+				seen[c.ID]++
+			}
+
+			if next == "" {
+				break
+			}
+
+			cursor = next
+		}
+
+		for id := range want {
+			if seen[id] != 1 {
+				t.Errorf("Scan visited %s %d times, want 1", id, seen[id])
+			}
+		}
+	})
+
+	t.Run("Scan invalid cursor", func(t *testing.T) {
+		_, _, err := s.Scan(ctx, 10, "not a cursor")
+		if err != tuc.ErrInvalidCursor {
+			t.Fatalf("Scan = %v, want %v", err, tuc.ErrInvalidCursor)
+		}
+	})
+}
+
+// TestUserService tests that s behaves as a tuc.UserService.
+func TestUserService(t *testing.T, s tuc.UserService) {
+	ctx := context.Background()
+
+	t.Run("Find missing", func(t *testing.T) {
+		u, err := s.Find(ctx, newID())
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+
+		if u != nil {
+			t.Fatalf("Find = %+v, want nil", u)
+		}
+	})
+
+	t.Run("Create and Find", func(t *testing.T) {
+		want := &tuc.User{ID: newID()}
+		mustCreateUser(t, s, want)
+
+		got, err := s.Find(ctx, want.ID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Find = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("FindByEmail", func(t *testing.T) {
+		want := &tuc.User{ID: newID(), Email: newID() + "@b.c"}
+		mustCreateUser(t, s, want)
+
+		got, err := s.FindByEmail(ctx, want.Email)
+		if err != nil {
+			t.Fatalf("FindByEmail: %v", err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("FindByEmail = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("FindByEmail missing", func(t *testing.T) {
+		u, err := s.FindByEmail(ctx, newID()+"@b.c")
+		if err != nil {
+			t.Fatalf("FindByEmail: %v", err)
+		}
+
+		if u != nil {
+			t.Fatalf("FindByEmail = %+v, want nil", u)
+		}
+	})
+
+	t.Run("Create taken email", func(t *testing.T) {
+		want := &tuc.User{ID: newID(), Email: newID() + "@b.c"}
+		mustCreateUser(t, s, want)
+
+		if err := s.Create(ctx, &tuc.User{ID: newID(), Email: want.Email}); err != tuc.ErrEmailTaken {
+			t.Fatalf("Create = %v, want %v", err, tuc.ErrEmailTaken)
+		}
+
+		got, err := s.FindByEmail(ctx, want.Email)
+		if err != nil {
+			t.Fatalf("FindByEmail: %v", err)
+		}
+
+		if got == nil || got.ID != want.ID {
+			t.Fatalf("FindByEmail = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("ChangeEmail", func(t *testing.T) {
+		u := &tuc.User{ID: newID(), Email: newID() + "@b.c"}
+		mustCreateUser(t, s, u)
+
+		email := newID() + "@b.c"
+
+		if err := s.ChangeEmail(ctx, u.ID, email); err != nil {
+			t.Fatalf("ChangeEmail: %v", err)
+		}
+
+		got, err := s.FindByEmail(ctx, email)
+		if err != nil {
+			t.Fatalf("FindByEmail: %v", err)
+		}
+
+		if got == nil || got.ID != u.ID || got.Email != email {
+			t.Fatalf("FindByEmail = %+v, want %s with email %s", got, u.ID, email)
+		}
+
+		// the old email is free for other users
+		if err := s.Create(ctx, &tuc.User{ID: newID(), Email: u.Email}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	})
+
+	t.Run("ChangeEmail taken", func(t *testing.T) {
+		u := &tuc.User{ID: newID(), Email: newID() + "@b.c"}
+		other := &tuc.User{ID: newID(), Email: newID() + "@b.c"}
+		mustCreateUser(t, s, u)
+		mustCreateUser(t, s, other)
+
+		if err := s.ChangeEmail(ctx, u.ID, other.Email); err != tuc.ErrEmailTaken {
+			t.Fatalf("ChangeEmail = %v, want %v", err, tuc.ErrEmailTaken)
+		}
+
+		got, err := s.Find(ctx, u.ID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+
+		if got == nil || got.Email != u.Email {
+			t.Fatalf("Find = %+v, want email %s", got, u.Email)
+		}
+	})
+
+	t.Run("Create with identities", func(t *testing.T) {
+		want := &tuc.User{
+			ID:         newID(),
+			Identities: map[string]string{"facebook": newID()},
+		}
+		mustCreateUser(t, s, want)
+
+		got, err := s.Find(ctx, want.ID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Find = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("FindByIdentity", func(t *testing.T) {
+		want := &tuc.User{ID: newID(), Identities: map[string]string{"google": newID()}}
+		mustCreateUser(t, s, want)
+
+		got, err := s.FindByIdentity(ctx, "google", want.Identities["google"])
+		if err != nil {
+			t.Fatalf("FindByIdentity: %v", err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("FindByIdentity = %+v, want %+v", got, want)
+		}
+
+		// subjects are per provider
+		got, err = s.FindByIdentity(ctx, "facebook", want.Identities["google"])
+		if err != nil {
+			t.Fatalf("FindByIdentity: %v", err)
+		}
+
+		if got != nil {
+			t.Fatalf("FindByIdentity = %+v, want nil", got)
+		}
+	})
+
+	t.Run("Create taken identity", func(t *testing.T) {
+		want := &tuc.User{ID: newID(), Identities: map[string]string{"google": newID()}}
+		mustCreateUser(t, s, want)
+
+		err := s.Create(ctx, &tuc.User{ID: newID(), Email: newID() + "@b.c", Identities: want.Identities})
+		if err != tuc.ErrIdentityTaken {
+			t.Fatalf("Create = %v, want %v", err, tuc.ErrIdentityTaken)
+		}
+
+		got, err := s.FindByIdentity(ctx, "google", want.Identities["google"])
+		if err != nil {
+			t.Fatalf("FindByIdentity: %v", err)
+		}
+
+		if got == nil || got.ID != want.ID {
+			t.Fatalf("FindByIdentity = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("Link replaces identity", func(t *testing.T) {
+		u := &tuc.User{ID: newID()}
+		mustCreateUser(t, s, u)
+
+		old, subject := newID(), newID()
+
+		for _, sub := range []string{old, subject} {
+			if err := s.Link(ctx, u.ID, "google", sub); err != nil {
+				t.Fatalf("Link: %v", err)
+			}
+		}
+
+		if got, err := s.FindByIdentity(ctx, "google", subject); err != nil || got == nil || got.ID != u.ID {
+			t.Fatalf("FindByIdentity = %+v, %v, want %s", got, err, u.ID)
+		}
+
+		// the replaced subject is free for other users
+		if err := s.Link(ctx, newID(), "google", old); err != nil {
+			t.Fatalf("Link: %v", err)
+		}
+	})
+
+	t.Run("Link taken identity", func(t *testing.T) {
+		u := &tuc.User{ID: newID(), Identities: map[string]string{"google": newID()}}
+		other := &tuc.User{ID: newID()}
+		mustCreateUser(t, s, u)
+		mustCreateUser(t, s, other)
+
+		if err := s.Link(ctx, other.ID, "google", u.Identities["google"]); err != tuc.ErrIdentityTaken {
+			t.Fatalf("Link = %v, want %v", err, tuc.ErrIdentityTaken)
+		}
+
+		// linking again is a no-op
+		if err := s.Link(ctx, u.ID, "google", u.Identities["google"]); err != nil {
+			t.Fatalf("Link: %v", err)
+		}
+	})
+
+	t.Run("Link", func(t *testing.T) {
+		u := &tuc.User{ID: newID()}
+		mustCreateUser(t, s, u)
+
+		want := &tuc.User{
+			ID: u.ID,
+			Identities: map[string]string{
+				"facebook": "f2",
+				"google":   "g1",
+			},
+		}
+
+		// linking again replaces the subject, leaving other providers alone
+		for _, i := range [][2]string{{"facebook", "f1"}, {"google", "g1"}, {"facebook", "f2"}} {
+			if err := s.Link(ctx, u.ID, i[0], i[1]); err != nil {
+				t.Fatalf("Link: %v", err)
+			}
+		}
+
+		got, err := s.Find(ctx, u.ID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Find = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("Default notifications", func(t *testing.T) {
+		u := &tuc.User{ID: newID()}
+		mustCreateUser(t, s, u)
+
+		got, err := s.Find(ctx, u.ID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+
+		if p := got.Preferences(); p != tuc.DefaultNotificationPreferences {
+			t.Fatalf("Preferences = %+v, want defaults", p)
+		}
+	})
+
+	t.Run("UpdateNotifications", func(t *testing.T) {
+		u := &tuc.User{ID: newID(), Identities: map[string]string{"facebook": newID()}}
+		mustCreateUser(t, s, u)
+
+		want := tuc.NotificationPreferences{
+			Email:           false,
+			Language:        "en",
+			Push:            true,
+			QuietHoursEnd:   "07:00",
+			QuietHoursStart: "22:00",
+		}
+
+		if err := s.UpdateNotifications(ctx, u.ID, &want); err != nil {
+			t.Fatalf("UpdateNotifications: %v", err)
+		}
+
+		got, err := s.Find(ctx, u.ID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+
+		if p := got.Preferences(); p != want {
+			t.Fatalf("Preferences = %+v, want %+v", p, want)
+		}
+
+		if !reflect.DeepEqual(got.Identities, u.Identities) {
+			t.Fatalf("Identities = %v, want %v", got.Identities, u.Identities)
+		}
+	})
+}
+
+// TestLoginRequestService tests that s behaves as a tuc.LoginRequestService.
+func TestLoginRequestService(t *testing.T, s tuc.LoginRequestService) {
+	ctx := context.Background()
+
+	t.Run("Verify missing", func(t *testing.T) {
+		if err := s.Verify(ctx, newID(), newID()); err != tuc.ErrInvalidLoginRequest {
+			t.Fatalf("Verify = %v, want %v", err, tuc.ErrInvalidLoginRequest)
+		}
+	})
+
+	t.Run("Verify wrong token", func(t *testing.T) {
+		r := newLoginRequest()
+		mustCreateLoginRequest(t, s, r)
+
+		if err := s.Verify(ctx, r.UserID, newID()); err != tuc.ErrInvalidLoginRequest {
+			t.Fatalf("Verify = %v, want %v", err, tuc.ErrInvalidLoginRequest)
+		}
+	})
+
+	t.Run("Verify is one-shot", func(t *testing.T) {
+		r := newLoginRequest()
+		mustCreateLoginRequest(t, s, r)
+
+		if err := s.Verify(ctx, r.UserID, r.VerificationToken); err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+
+		if err := s.Verify(ctx, r.UserID, r.VerificationToken); err != tuc.ErrInvalidLoginRequest {
+			t.Fatalf("second Verify = %v, want %v", err, tuc.ErrInvalidLoginRequest)
+		}
+	})
+
+	t.Run("Delete requires verification", func(t *testing.T) {
+		r := newLoginRequest()
+		mustCreateLoginRequest(t, s, r)
+
+		if err := s.Delete(ctx, r.UserID, r.RequestToken); err != tuc.ErrInvalidLoginRequest {
+			t.Fatalf("Delete = %v, want %v", err, tuc.ErrInvalidLoginRequest)
+		}
+	})
+
+	t.Run("Delete wrong code", func(t *testing.T) {
+		r := newLoginRequest()
+		mustCreateLoginRequest(t, s, r)
+
+		if err := s.Verify(ctx, r.UserID, r.VerificationToken); err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+
+		if err := s.Delete(ctx, r.UserID, newID()); err != tuc.ErrInvalidLoginRequest {
+			t.Fatalf("Delete = %v, want %v", err, tuc.ErrInvalidLoginRequest)
+		}
+	})
+
+	t.Run("Delete after verification", func(t *testing.T) {
+		r := newLoginRequest()
+		mustCreateLoginRequest(t, s, r)
+
+		if err := s.Verify(ctx, r.UserID, r.VerificationToken); err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+
+		if err := s.Delete(ctx, r.UserID, r.RequestToken); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+
+		if err := s.Delete(ctx, r.UserID, r.RequestToken); err != tuc.ErrInvalidLoginRequest {
+			t.Fatalf("second Delete = %v, want %v", err, tuc.ErrInvalidLoginRequest)
+		}
+	})
+
+	t.Run("Create replaces pending request", func(t *testing.T) {
+		old := newLoginRequest()
+		mustCreateLoginRequest(t, s, old)
+
+		r := newLoginRequest()
+		r.UserID = old.UserID
+		mustCreateLoginRequest(t, s, r)
+
+		if err := s.Verify(ctx, r.UserID, old.VerificationToken); err != tuc.ErrInvalidLoginRequest {
+			t.Fatalf("Verify with replaced token = %v, want %v", err, tuc.ErrInvalidLoginRequest)
+		}
+
+		if err := s.Verify(ctx, r.UserID, r.VerificationToken); err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+	})
+}
+
+// TestRefreshTokenService tests that s behaves as a tuc.RefreshTokenService.
+func TestRefreshTokenService(t *testing.T, s tuc.RefreshTokenService) {
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	t.Run("Rotate", func(t *testing.T) {
+		token := mustCreateRefreshToken(t, s)
+
+		got, err := s.Rotate(ctx, token.FamilyID, token.Hash, "next", expiresAt)
+		if err != nil {
+			t.Fatalf("Rotate: %v", err)
+		}
+
+		if got.Hash != "next" || !got.ExpiresAt.Equal(expiresAt) || got.UserID != token.UserID {
+			t.Fatalf("Rotate = %+v, want hash next until %v", got, expiresAt)
+		}
+
+		if _, err := s.Rotate(ctx, token.FamilyID, "next", "last", expiresAt); err != nil {
+			t.Fatalf("Rotate: %v", err)
+		}
+	})
+
+	t.Run("Rotate unknown hash", func(t *testing.T) {
+		token := mustCreateRefreshToken(t, s)
+
+		if _, err := s.Rotate(ctx, token.FamilyID, newID(), "next", expiresAt); err != tuc.ErrRefreshTokenReused {
+			t.Fatalf("Rotate = %v, want %v", err, tuc.ErrRefreshTokenReused)
+		}
+
+		if _, err := s.Rotate(ctx, token.FamilyID, token.Hash, "next", expiresAt); err != tuc.ErrInvalidRefreshToken {
+			t.Fatalf("Rotate after reuse = %v, want %v", err, tuc.ErrInvalidRefreshToken)
+		}
+	})
+
+	t.Run("Rotate missing", func(t *testing.T) {
+		if _, err := s.Rotate(ctx, newID(), newID(), "next", expiresAt); err != tuc.ErrInvalidRefreshToken {
+			t.Fatalf("Rotate = %v, want %v", err, tuc.ErrInvalidRefreshToken)
+		}
+	})
+
+	t.Run("Rotate expired", func(t *testing.T) {
+		token := newRefreshToken()
+		token.ExpiresAt = time.Now().Add(-time.Minute)
+
+		if err := s.Create(ctx, token); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		if _, err := s.Rotate(ctx, token.FamilyID, token.Hash, "next", expiresAt); err != tuc.ErrInvalidRefreshToken {
+			t.Fatalf("Rotate = %v, want %v", err, tuc.ErrInvalidRefreshToken)
+		}
+	})
+
+	t.Run("Reuse revokes the family", func(t *testing.T) {
+		token := mustCreateRefreshToken(t, s)
+
+		if _, err := s.Rotate(ctx, token.FamilyID, token.Hash, "next", expiresAt); err != nil {
+			t.Fatalf("Rotate: %v", err)
+		}
+
+		if _, err := s.Rotate(ctx, token.FamilyID, token.Hash, "other", expiresAt); err != tuc.ErrRefreshTokenReused {
+			t.Fatalf("Rotate reused = %v, want %v", err, tuc.ErrRefreshTokenReused)
+		}
+
+		if _, err := s.Rotate(ctx, token.FamilyID, "next", "last", expiresAt); err != tuc.ErrInvalidRefreshToken {
+			t.Fatalf("Rotate after reuse = %v, want %v", err, tuc.ErrInvalidRefreshToken)
+		}
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		token := mustCreateRefreshToken(t, s)
+
+		if err := s.Revoke(ctx, token.FamilyID); err != nil {
+			t.Fatalf("Revoke: %v", err)
+		}
+
+		if _, err := s.Rotate(ctx, token.FamilyID, token.Hash, "next", expiresAt); err != tuc.ErrInvalidRefreshToken {
+			t.Fatalf("Rotate = %v, want %v", err, tuc.ErrInvalidRefreshToken)
+		}
+	})
+
+	t.Run("Revoke missing", func(t *testing.T) {
+		if err := s.Revoke(ctx, newID()); err != nil {
+			t.Fatalf("Revoke: %v", err)
+		}
+	})
+
+	t.Run("RevokeUser", func(t *testing.T) {
+		token, other, kept := newRefreshToken(), newRefreshToken(), mustCreateRefreshToken(t, s)
+		other.UserID = token.UserID
+
+		for _, tk := range []*tuc.RefreshToken{token, other} {
+			if err := s.Create(ctx, tk); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+
+		if err := s.RevokeUser(ctx, token.UserID); err != nil {
+			t.Fatalf("RevokeUser: %v", err)
+		}
+
+		for _, tk := range []*tuc.RefreshToken{token, other} {
+			if _, err := s.Rotate(ctx, tk.FamilyID, tk.Hash, "next", expiresAt); err != tuc.ErrInvalidRefreshToken {
+				t.Fatalf("Rotate = %v, want %v", err, tuc.ErrInvalidRefreshToken)
+			}
+		}
+
+		if _, err := s.Rotate(ctx, kept.FamilyID, kept.Hash, "next", expiresAt); err != nil {
+			t.Fatalf("Rotate other user: %v", err)
+		}
+	})
+}
+
+// TestRevocationService tests that s behaves as a tuc.RevocationService.
+func TestRevocationService(t *testing.T, s tuc.RevocationService) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	expiresAt := now.Add(time.Hour)
+
+	t.Run("Find none", func(t *testing.T) {
+		r, err := s.Find(ctx, newID())
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+
+		if r != nil {
+			t.Fatalf("Find = %+v, want nil", r)
+		}
+	})
+
+	t.Run("RevokeSession", func(t *testing.T) {
+		userID := newID()
+
+		for _, sid := range []string{"a", "b"} {
+			if err := s.RevokeSession(ctx, userID, sid, expiresAt); err != nil {
+				t.Fatalf("RevokeSession: %v", err)
+			}
+		}
+
+		r, err := s.Find(ctx, userID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+
+		if r == nil || !r.ExpiresAt.Equal(expiresAt) {
+			t.Fatalf("Find = %+v, want expiring at %v", r, expiresAt)
+		}
+
+		if !r.Revoked("a", now) || !r.Revoked("b", now) || r.Revoked("c", now) {
+			t.Fatalf("Find = %+v, want sessions a and b revoked", r)
+		}
+	})
+
+	t.Run("RevokeAll", func(t *testing.T) {
+		userID := newID()
+
+		if err := s.RevokeSession(ctx, userID, "a", expiresAt); err != nil {
+			t.Fatalf("RevokeSession: %v", err)
+		}
+
+		// kept in whole seconds like iat
+		if err := s.RevokeAll(ctx, userID, now.Add(500*time.Millisecond), expiresAt); err != nil {
+			t.Fatalf("RevokeAll: %v", err)
+		}
+
+		r, err := s.Find(ctx, userID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+
+		if r == nil || !r.NotBefore.Equal(now) {
+			t.Fatalf("Find = %+v, want not before %v", r, now)
+		}
+
+		if !r.Revoked("b", now.Add(-time.Second)) || !r.Revoked("a", now.Add(time.Second)) {
+			t.Fatalf("Find = %+v, want tokens before %v and session a revoked", r, now)
+		}
+	})
+
+	t.Run("RevokeAll keeps tokens of the same second", func(t *testing.T) {
+		userID := newID()
+
+		if err := s.RevokeAll(ctx, userID, now.Add(500*time.Millisecond), expiresAt); err != nil {
+			t.Fatalf("RevokeAll: %v", err)
+		}
+
+		r, err := s.Find(ctx, userID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+
+		for _, issuedAt := range []time.Time{now, now.Add(900 * time.Millisecond), now.Add(time.Second)} {
+			if r.Revoked("b", issuedAt) {
+				t.Fatalf("Find = %+v, want a token issued at %v kept", r, issuedAt)
+			}
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		userID := newID()
+
+		if err := s.RevokeSession(ctx, userID, "a", now.Add(-time.Minute)); err != nil {
+			t.Fatalf("RevokeSession: %v", err)
+		}
+
+		r, err := s.Find(ctx, userID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+
+		if r != nil {
+			t.Fatalf("Find = %+v, want nil", r)
+		}
+
+		// an expired revocation is not carried over
+		if err := s.RevokeSession(ctx, userID, "b", expiresAt); err != nil {
+			t.Fatalf("RevokeSession: %v", err)
+		}
+
+		r, err = s.Find(ctx, userID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+
+		if r == nil || r.Revoked("a", now) || !r.Revoked("b", now) {
+			t.Fatalf("Find = %+v, want only session b revoked", r)
+		}
+	})
+}
+
+// TestEmailChangeService tests that s behaves as a tuc.EmailChangeService.
+func TestEmailChangeService(t *testing.T, s tuc.EmailChangeService) {
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	t.Run("Confirm", func(t *testing.T) {
+		c := mustCreateEmailChange(t, s)
+		later := expiresAt.Add(time.Hour)
+
+		got, err := s.Confirm(ctx, c.UserID, c.ConfirmToken, later)
+		if err != nil {
+			t.Fatalf("Confirm: %v", err)
+		}
+
+		want := *c
+		want.Confirmed = true
+		want.ExpiresAt = later
+
+		if !got.ExpiresAt.Equal(later) {
+			t.Fatalf("Confirm = %+v, want %+v", got, want)
+		}
+
+		got.ExpiresAt = later
+
+		if *got != want {
+			t.Fatalf("Confirm = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("Confirm wrong token", func(t *testing.T) {
+		c := mustCreateEmailChange(t, s)
+
+		for _, token := range []string{newID(), c.CancelToken} {
+			if _, err := s.Confirm(ctx, c.UserID, token, expiresAt); err != tuc.ErrInvalidEmailChange {
+				t.Fatalf("Confirm = %v, want %v", err, tuc.ErrInvalidEmailChange)
+			}
+		}
+	})
+
+	t.Run("Confirm twice", func(t *testing.T) {
+		c := mustCreateEmailChange(t, s)
+
+		if _, err := s.Confirm(ctx, c.UserID, c.ConfirmToken, expiresAt); err != nil {
+			t.Fatalf("Confirm: %v", err)
+		}
+
+		if _, err := s.Confirm(ctx, c.UserID, c.ConfirmToken, expiresAt); err != tuc.ErrInvalidEmailChange {
+			t.Fatalf("Confirm = %v, want %v", err, tuc.ErrInvalidEmailChange)
+		}
+	})
+
+	t.Run("Confirm expired", func(t *testing.T) {
+		c := newEmailChange()
+		c.ExpiresAt = time.Now().Add(-time.Minute)
+
+		if err := s.Create(ctx, c); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		if _, err := s.Confirm(ctx, c.UserID, c.ConfirmToken, expiresAt); err != tuc.ErrInvalidEmailChange {
+			t.Fatalf("Confirm = %v, want %v", err, tuc.ErrInvalidEmailChange)
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		c := mustCreateEmailChange(t, s)
+
+		got, err := s.Cancel(ctx, c.UserID, c.CancelToken)
+		if err != nil {
+			t.Fatalf("Cancel: %v", err)
+		}
+
+		if got.Confirmed || got.NewEmail != c.NewEmail || got.OldEmail != c.OldEmail {
+			t.Fatalf("Cancel = %+v, want %+v", got, c)
+		}
+
+		// cancelling deletes the change
+		if _, err := s.Confirm(ctx, c.UserID, c.ConfirmToken, expiresAt); err != tuc.ErrInvalidEmailChange {
+			t.Fatalf("Confirm = %v, want %v", err, tuc.ErrInvalidEmailChange)
+		}
+	})
+
+	t.Run("Cancel confirmed", func(t *testing.T) {
+		c := mustCreateEmailChange(t, s)
+
+		if _, err := s.Confirm(ctx, c.UserID, c.ConfirmToken, expiresAt); err != nil {
+			t.Fatalf("Confirm: %v", err)
+		}
+
+		got, err := s.Cancel(ctx, c.UserID, c.CancelToken)
+		if err != nil {
+			t.Fatalf("Cancel: %v", err)
+		}
+
+		if !got.Confirmed {
+			t.Fatalf("Cancel = %+v, want confirmed", got)
+		}
+
+		if _, err := s.Cancel(ctx, c.UserID, c.CancelToken); err != tuc.ErrInvalidEmailChange {
+			t.Fatalf("Cancel = %v, want %v", err, tuc.ErrInvalidEmailChange)
+		}
+	})
+
+	t.Run("Cancel wrong token", func(t *testing.T) {
+		c := mustCreateEmailChange(t, s)
+
+		for _, token := range []string{newID(), c.ConfirmToken} {
+			if _, err := s.Cancel(ctx, c.UserID, token); err != tuc.ErrInvalidEmailChange {
+				t.Fatalf("Cancel = %v, want %v", err, tuc.ErrInvalidEmailChange)
+			}
+		}
+	})
+
+	t.Run("Create replaces pending change", func(t *testing.T) {
+		old := mustCreateEmailChange(t, s)
+		c := newEmailChange()
+		c.UserID = old.UserID
+
+		if err := s.Create(ctx, c); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		if _, err := s.Confirm(ctx, c.UserID, old.ConfirmToken, expiresAt); err != tuc.ErrInvalidEmailChange {
+			t.Fatalf("Confirm = %v, want %v", err, tuc.ErrInvalidEmailChange)
+		}
+
+		if _, err := s.Confirm(ctx, c.UserID, c.ConfirmToken, expiresAt); err != nil {
+			t.Fatalf("Confirm: %v", err)
+		}
+
+		// a confirmed change is kept for its cancel link
+		next := newEmailChange()
+		next.UserID = c.UserID
+
+		if err := s.Create(ctx, next); err != tuc.ErrEmailChangePending {
+			t.Fatalf("Create = %v, want %v", err, tuc.ErrEmailChangePending)
+		}
+
+		if _, err := s.Cancel(ctx, c.UserID, c.CancelToken); err != nil {
+			t.Fatalf("Cancel: %v", err)
+		}
+	})
+
+	t.Run("Create replaces expired change", func(t *testing.T) {
+		old := newEmailChange()
+		old.ExpiresAt = time.Now().Add(-time.Minute)
+
+		if err := s.Create(ctx, old); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		c := newEmailChange()
+		c.UserID = old.UserID
+
+		if err := s.Create(ctx, c); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	})
+}
+
+// TestCursorService tests that s behaves as a tuc.CursorService.
+func TestCursorService(t *testing.T, s tuc.CursorService) {
+	ctx := context.Background()
+
+	t.Run("Get missing", func(t *testing.T) {
+		got, err := s.Get(ctx, newID())
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+
+		if got != "" {
+			t.Fatalf("Get = %q, want empty", got)
+		}
+	})
+
+	t.Run("Put and Get", func(t *testing.T) {
+		name := newID()
+
+		for _, want := range []string{"a", "b", ""} {
+			if err := s.Put(ctx, name, want); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+
+			got, err := s.Get(ctx, name)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+
+			if got != want {
+				t.Fatalf("Get = %q, want %q", got, want)
+			}
+		}
+	})
+}
+
+// TestCardInviteService tests that s behaves as a tuc.CardInviteService.
+func TestCardInviteService(t *testing.T, s tuc.CardInviteService) {
+	ctx := context.Background()
+
+	newInvite := func(cardID, email string) *tuc.CardInvite {
+		return &tuc.CardInvite{
+			CardID:     cardID,
+			Email:      email,
+			OwnerID:    newID(),
+			Permission: tuc.CardPermissionRead,
+		}
+	}
+
+	t.Run("List empty", func(t *testing.T) {
+		invites, err := s.List(ctx, newID())
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+
+		if invites == nil || len(invites) != 0 {
+			t.Fatalf("List = %#v, want an empty slice", invites)
+		}
+
+		invites, err = s.ListByEmail(ctx, newID()+"@b.c")
+		if err != nil {
+			t.Fatalf("ListByEmail: %v", err)
+		}
+
+		if invites == nil || len(invites) != 0 {
+			t.Fatalf("ListByEmail = %#v, want an empty slice", invites)
+		}
+	})
+
+	t.Run("Create and List", func(t *testing.T) {
+		cardID := newID()
+		a, b := newInvite(cardID, "a"+newID()+"@b.c"), newInvite(cardID, "b"+newID()+"@b.c")
+
+		mustCreateInvite(t, s, b)
+		mustCreateInvite(t, s, a)
+
+		invites, err := s.List(ctx, cardID)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+
+		if want := []tuc.CardInvite{*a, *b}; !reflect.DeepEqual(invites, want) {
+			t.Fatalf("List = %+v, want %+v", invites, want)
+		}
+	})
+
+	t.Run("Create replaces permission", func(t *testing.T) {
+		i := newInvite(newID(), newID()+"@b.c")
+		mustCreateInvite(t, s, i)
+
+		i.Permission = tuc.CardPermissionManage
+		mustCreateInvite(t, s, i)
+
+		invites, err := s.List(ctx, i.CardID)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+
+		if want := []tuc.CardInvite{*i}; !reflect.DeepEqual(invites, want) {
+			t.Fatalf("List = %+v, want %+v", invites, want)
+		}
+	})
+
+	t.Run("ListByEmail", func(t *testing.T) {
+		email := newID() + "@b.c"
+		a, b := newInvite("a"+newID(), email), newInvite("b"+newID(), email)
+
+		for _, i := range []*tuc.CardInvite{b, a, newInvite(a.CardID, newID()+"@b.c")} {
+			mustCreateInvite(t, s, i)
+		}
+
+		invites, err := s.ListByEmail(ctx, email)
+		if err != nil {
+			t.Fatalf("ListByEmail: %v", err)
+		}
+
+		if want := []tuc.CardInvite{*a, *b}; !reflect.DeepEqual(invites, want) {
+			t.Fatalf("ListByEmail = %+v, want %+v", invites, want)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		i := newInvite(newID(), newID()+"@b.c")
+		mustCreateInvite(t, s, i)
+
+		if err := s.Delete(ctx, i.CardID, i.Email); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+
+		invites, err := s.ListByEmail(ctx, i.Email)
+		if err != nil {
+			t.Fatalf("ListByEmail: %v", err)
+		}
+
+		if len(invites) != 0 {
+			t.Fatalf("ListByEmail = %+v, want no invites", invites)
+		}
+
+		// deleting it again is not an error
+		if err := s.Delete(ctx, i.CardID, i.Email); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+	})
+}
+
+// TestBalanceHistoryService tests that s behaves as a tuc.BalanceHistoryService.
+func TestBalanceHistoryService(t *testing.T, s tuc.BalanceHistoryService) {
+	ctx := context.Background()
+	t0 := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// appendSnapshots appends a snapshot a minute apart for each balance.
+	appendSnapshots := func(t *testing.T, cardID string, balances ...float64) []tuc.BalanceSnapshot {
+		t.Helper()
+
+		var snapshots []tuc.BalanceSnapshot
+
+		for i, b := range balances {
+			snapshot := tuc.BalanceSnapshot{
+				Balance: b,
+				CardID:  cardID,
+				Time:    t0.Add(time.Duration(i) * time.Minute),
+			}
+
+			if err := s.Append(ctx, &snapshot); err != nil {
+				t.Fatalf("Append: %v", err)
+			}
+
+			snapshots = append(snapshots, snapshot)
+		}
+
+		return snapshots
+	}
+
+	t.Run("List empty", func(t *testing.T) {
+		snapshots, cursor, err := s.List(ctx, newID(), time.Time{}, time.Time{}, 10, "")
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+
+		if len(snapshots) != 0 || cursor != "" {
+			t.Fatalf("List = %+v, %q, want no snapshots", snapshots, cursor)
+		}
+	})
+
+	t.Run("List oldest first and scoped per card", func(t *testing.T) {
+		cardID := newID()
+		want := appendSnapshots(t, cardID, 30, 20, 10)
+		appendSnapshots(t, newID(), 5)
+
+		got := listAll(t, s, cardID, time.Time{}, time.Time{}, 10)
+		assertSnapshots(t, got, want)
+	})
+
+	t.Run("List between from and to", func(t *testing.T) {
+		cardID := newID()
+		all := appendSnapshots(t, cardID, 40, 30, 20, 10)
+
+		got := listAll(t, s, cardID, all[1].Time, all[2].Time, 10)
+		assertSnapshots(t, got, all[1:3])
+	})
+
+	t.Run("List pages", func(t *testing.T) {
+		cardID := newID()
+		want := appendSnapshots(t, cardID, 50, 40, 30, 20, 10)
+
+		first, cursor, err := s.List(ctx, cardID, time.Time{}, time.Time{}, 2, "")
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+
+		if len(first) != 2 || cursor == "" {
+			t.Fatalf("List returned %d snapshots and cursor %q, want 2 and a cursor", len(first), cursor)
+		}
+
+		got := append(first, listAll(t, s, cardID, time.Time{}, time.Time{}, 2, cursor)...)
+		assertSnapshots(t, got, want)
+	})
+
+	t.Run("List invalid cursor", func(t *testing.T) {
+		_, _, err := s.List(ctx, newID(), time.Time{}, time.Time{}, 10, "not a cursor")
+		if err != tuc.ErrInvalidCursor {
+			t.Fatalf("List = %v, want %v", err, tuc.ErrInvalidCursor)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		cardID, otherID := newID(), newID()
+		appendSnapshots(t, cardID, 30, 20, 10)
+		want := appendSnapshots(t, otherID, 5)
+
+		if err := s.Delete(ctx, cardID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+
+		assertSnapshots(t, listAll(t, s, cardID, time.Time{}, time.Time{}, 10), nil)
+		assertSnapshots(t, listAll(t, s, otherID, time.Time{}, time.Time{}, 10), want)
+	})
+
+	t.Run("Delete missing", func(t *testing.T) {
+		if err := s.Delete(ctx, newID()); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+	})
+}
+
+// TestCardEventService tests that s behaves as a tuc.CardEventService.
+func TestCardEventService(t *testing.T, s tuc.CardEventService) {
+	ctx := context.Background()
+	t0 := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	createEvents := func(t *testing.T, cardID string, n int) []tuc.CardEvent {
+		t.Helper()
+
+		var events []tuc.CardEvent
+
+		for i := 0; i < n; i++ {
+			e := tuc.CardEvent{
+				Amount:  2.5,
+				Balance: float64(100 - i),
+				CardID:  cardID,
+				Time:    t0.Add(time.Duration(i) * time.Hour),
+				Trips:   1,
+				Type:    tuc.CardEventTrip,
+			}
+
+			if err := s.Create(ctx, &e); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+
+			events = append(events, e)
+		}
+
+		return events
+	}
+
+	listAll := func(t *testing.T, cardID string, from, to time.Time, limit int) []tuc.CardEvent {
+		t.Helper()
+
+		all := []tuc.CardEvent{}
+		cursor := ""
+
+		for i := 0; i < 100; i++ {
+			events, next, err := s.List(ctx, cardID, from, to, limit, cursor)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+
+			all = append(all, events...)
+
+			if next == "" {
+				return all
+			}
+
+			cursor = next
+		}
+
+		t.Fatal("List did not return the last page")
+		return nil
+	}
+
+	assertEvents := func(t *testing.T, got, want []tuc.CardEvent) {
+		t.Helper()
+
+		if len(got) != len(want) {
+			t.Fatalf("got %d events, want %d", len(got), len(want))
+		}
+
+		for i := range got {
+			g, w := got[i], want[i]
+
+			if !g.Time.Equal(w.Time) {
+				t.Fatalf("event %d = %+v, want %+v", i, g, w)
+			}
+
+			g.Time, w.Time = time.Time{}, time.Time{}
+
+			if g != w {
+				t.Fatalf("event %d = %+v, want %+v", i, got[i], want[i])
+			}
+		}
+	}
+
+	t.Run("List oldest first and scoped per card", func(t *testing.T) {
+		cardID := newID()
+		want := createEvents(t, cardID, 3)
+		createEvents(t, newID(), 1)
+
+		assertEvents(t, listAll(t, cardID, time.Time{}, time.Time{}, 10), want)
+	})
+
+	t.Run("List between from and to", func(t *testing.T) {
+		cardID := newID()
+		all := createEvents(t, cardID, 4)
+
+		assertEvents(t, listAll(t, cardID, all[1].Time, all[2].Time, 10), all[1:3])
+	})
+
+	t.Run("List pages", func(t *testing.T) {
+		cardID := newID()
+		want := createEvents(t, cardID, 5)
+
+		assertEvents(t, listAll(t, cardID, time.Time{}, time.Time{}, 2), want)
+	})
+
+	t.Run("List invalid cursor", func(t *testing.T) {
+		_, _, err := s.List(ctx, newID(), time.Time{}, time.Time{}, 10, "not a cursor")
+		if err != tuc.ErrInvalidCursor {
+			t.Fatalf("List = %v, want %v", err, tuc.ErrInvalidCursor)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		cardID, otherID := newID(), newID()
+
+		// more than a batch of deletes
+		createEvents(t, cardID, 30)
+		want := createEvents(t, otherID, 1)
+
+		if err := s.Delete(ctx, cardID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+
+		assertEvents(t, listAll(t, cardID, time.Time{}, time.Time{}, 10), nil)
+		assertEvents(t, listAll(t, otherID, time.Time{}, time.Time{}, 10), want)
+	})
+}
+
+// listAll follows the cursor starting at cursor until the last page.
+func listAll(t *testing.T, s tuc.BalanceHistoryService, cardID string, from, to time.Time, limit int, cursor ...string) []tuc.BalanceSnapshot {
+	t.Helper()
+
+	var c string
+
+	if len(cursor) > 0 {
+		c = cursor[0]
+	}
+
+	all := []tuc.BalanceSnapshot{}
+
+	for i := 0; i < 100; i++ {
+		snapshots, next, err := s.List(context.Background(), cardID, from, to, limit, c)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+
+		all = append(all, snapshots...)
+
+		if next == "" {
+			return all
+		}
+
+		c = next
+	}
+
+	t.Fatal("List did not return the last page")
+	return nil
+}
+
+func assertSnapshots(t *testing.T, got, want []tuc.BalanceSnapshot) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d snapshots, want %d", len(got), len(want))
+	}
+
+	for i := range got {
+		if got[i].Balance != want[i].Balance || got[i].CardID != want[i].CardID || !got[i].Time.Equal(want[i].Time) {
+			t.Fatalf("snapshot %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func newID() string {
+	return uuid.NewV4().String()
+}
+
+// owned returns c as read by its owner.
+func owned(c tuc.Card) tuc.Card {
+	c.Permission = tuc.CardPermissionOwner
+	return c
+}
+
+// numbers is the last card number handed out by newCard.
+var numbers int64
+
+func newCard(userID string) *tuc.Card {
+	return &tuc.Card{
+		Balance: 10,
+		ID:      newID(),
+		Name:    "Card",
+		Number:  fmt.Sprintf("%08d", atomic.AddInt64(&numbers, 1)),
+		UserID:  userID,
+	}
+}
+
+func newLoginRequest() *tuc.LoginRequest {
+	return &tuc.LoginRequest{
+		RequestToken:      newID(),
+		UserID:            newID(),
+		VerificationToken: newID(),
+	}
+}
+
+func mustCreateCard(t *testing.T, s tuc.CardService, c *tuc.Card) {
+	t.Helper()
+
+	if err := s.Create(context.Background(), c); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+}
+
+func newRefreshToken() *tuc.RefreshToken {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	return &tuc.RefreshToken{
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+		FamilyID:  newID(),
+		Hash:      newID(),
+		UserID:    newID(),
+	}
+}
+
+func mustCreateRefreshToken(t *testing.T, s tuc.RefreshTokenService) *tuc.RefreshToken {
+	t.Helper()
+
+	token := newRefreshToken()
+
+	if err := s.Create(context.Background(), token); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	return token
+}
+
+func mustCreateUser(t *testing.T, s tuc.UserService, u *tuc.User) {
+	t.Helper()
+
+	if err := s.Create(context.Background(), u); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+}
+
+func mustCreateInvite(t *testing.T, s tuc.CardInviteService, i *tuc.CardInvite) {
+	t.Helper()
+
+	if err := s.Create(context.Background(), i); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+}
+
+func newEmailChange() *tuc.EmailChange {
+	return &tuc.EmailChange{
+		CancelToken:  newID(),
+		ConfirmToken: newID(),
+		ExpiresAt:    time.Now().Add(time.Hour).Truncate(time.Second),
+		NewEmail:     newID() + "@b.c",
+		OldEmail:     newID() + "@b.c",
+		UserID:       newID(),
+	}
+}
+
+func mustCreateEmailChange(t *testing.T, s tuc.EmailChangeService) *tuc.EmailChange {
+	t.Helper()
+
+	c := newEmailChange()
+
+	if err := s.Create(context.Background(), c); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	return c
+}
+
+func mustCreateLoginRequest(t *testing.T, s tuc.LoginRequestService, r *tuc.LoginRequest) {
+	t.Helper()
+
+	if err := s.Create(context.Background(), r); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+}
@@ -1,5 +1,58 @@
 package tuc
 
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Errors returned by services.
+var (
+	// ErrInvalidLoginRequest is returned when a login request does not exist
+	// or is not in the state required by the operation.
+	ErrInvalidLoginRequest = errors.New("invalid login request")
+
+	// ErrInvalidCursor is returned when a pagination cursor is malformed.
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	// ErrInvalidIdentityToken is returned when a token of an identity
+	// provider fails verification.
+	ErrInvalidIdentityToken = errors.New("invalid identity token")
+
+	// ErrInvalidRefreshToken is returned when a refresh token is unknown,
+	// expired or revoked.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+	// ErrRefreshTokenReused is returned when a refresh token is used after
+	// it was rotated, which revokes its family.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+
+	// ErrCardExists is returned when creating a card whose number the user
+	// already registered.
+	ErrCardExists = errors.New("card already exists")
+
+	// ErrBalanceChanged is returned when updating the balance of a card
+	// from a balance it no longer has.
+	ErrBalanceChanged = errors.New("balance changed")
+
+	// ErrEmailTaken is returned when creating a user with the email of
+	// another user.
+	ErrEmailTaken = errors.New("email already taken")
+
+	// ErrIdentityTaken is returned when linking a user to the subject of an
+	// identity provider linked to another user.
+	ErrIdentityTaken = errors.New("identity already taken")
+
+	// ErrInvalidEmailChange is returned when confirming or cancelling an
+	// email change with a wrong or expired token.
+	ErrInvalidEmailChange = errors.New("invalid email change")
+
+	// ErrEmailChangePending is returned when creating an email change while
+	// a confirmed one can still be cancelled.
+	ErrEmailChangePending = errors.New("email change pending")
+)
+
 // Card is an individual's card for an user.
 type Card struct {
 	Balance float64 `json:"balance"`
@@ -7,19 +60,199 @@ type Card struct {
 	Name    string  `json:"name"`
 	Number  string  `json:"number"`
 	UserID  string  `json:"-" dynamodbav:"u_id"`
+
+	// LowBalanceThreshold is the balance under which the user is alerted,
+	// disabled when zero.
+	LowBalanceThreshold float64 `json:"low_balance_threshold" dynamodbav:"low_balance_threshold,omitempty"`
+
+	// NotifyEmail and NotifyPush override the user's notification
+	// preferences for the card when set.
+	NotifyEmail *bool `json:"notify_email,omitempty" dynamodbav:"notify_email,omitempty"`
+	NotifyPush  *bool `json:"notify_push,omitempty" dynamodbav:"notify_push,omitempty"`
+
+	// Permission is what the user the card was read for may do with it.
+	// Only Get and List set it.
+	Permission CardPermission `json:"permission,omitempty" dynamodbav:"-"`
+}
+
+// CardPermission is what a user may do with a card.
+type CardPermission string
+
+// Card permissions. Owners may do anything with their cards; members with
+// manage permission may edit them and members with read permission only
+// check their balance and history.
+const (
+	CardPermissionOwner  CardPermission = "owner"
+	CardPermissionManage CardPermission = "manage"
+	CardPermissionRead   CardPermission = "read"
+)
+
+// CanManage reports whether p allows editing a card.
+func (p CardPermission) CanManage() bool {
+	return p == CardPermissionOwner || p == CardPermissionManage
+}
+
+// CardMember is a user a card is shared with.
+type CardMember struct {
+	CardID     string         `json:"-" dynamodbav:"card_id"`
+	OwnerID    string         `json:"-" dynamodbav:"owner_id"`
+	Permission CardPermission `json:"permission" dynamodbav:"permission"`
+	UserID     string         `json:"-" dynamodbav:"u_id"`
+
+	// Email is the current email of the user, filled in by the api.
+	Email string `json:"email" dynamodbav:"-"`
+
+	// Pending is set by the api on invites, for emails yet to log in.
+	Pending bool `json:"pending,omitempty" dynamodbav:"-"`
+}
+
+// CardInvite is a card shared with an email nobody logged in with yet, which
+// becomes a member once someone does.
+type CardInvite struct {
+	CardID     string         `json:"-" dynamodbav:"card_id"`
+	Email      string         `json:"email" dynamodbav:"email"`
+	OwnerID    string         `json:"-" dynamodbav:"owner_id"`
+	Permission CardPermission `json:"permission" dynamodbav:"permission"`
+}
+
+// CardPatch is a partial update of a card, leaving nil fields unchanged.
+type CardPatch struct {
+	LowBalanceThreshold *float64 `json:"low_balance_threshold"`
+	Name                *string  `json:"name"`
+	NotifyEmail         *bool    `json:"notify_email"`
+	NotifyPush          *bool    `json:"notify_push"`
 }
 
 // CardService represents a service for managing cards.
 type CardService interface {
-	List(userID string) ([]Card, error)
-	Get(userID, cardID string) (*Card, error)
-	Create(card *Card) error
-	Update(userID, cardID string, balance float64) (*Card, error)
-	Delete(userID, cardID string) error
+	// List returns the cards the user owns or which are shared with them.
+	List(ctx context.Context, userID string) ([]Card, error)
+
+	// Get returns a card the user owns or which is shared with them, or nil
+	// otherwise.
+	Get(ctx context.Context, userID, cardID string) (*Card, error)
+
+	// Create creates a card, returning ErrCardExists when the user already
+	// has a card with the same number or id.
+	Create(ctx context.Context, card *Card) error
+
+	// Update sets the balance of an existing card from prev, returning
+	// ErrBalanceChanged when its balance is no longer prev and nil when the
+	// card does not exist.
+	Update(ctx context.Context, userID, cardID string, prev, balance float64) (*Card, error)
+
+	// Patch applies a partial update to an existing card, returning nil when
+	// the card does not exist.
+	Patch(ctx context.Context, userID, cardID string, patch *CardPatch) (*Card, error)
+
+	// Delete deletes a card the user owns, and stops sharing it.
+	Delete(ctx context.Context, userID, cardID string) error
+
+	// Share shares a card with a user, replacing the permission of an
+	// existing member.
+	Share(ctx context.Context, member *CardMember) error
+
+	// Unshare stops sharing a card with a user.
+	Unshare(ctx context.Context, cardID, userID string) error
+
+	// Members lists the users a card is shared with.
+	Members(ctx context.Context, cardID string) ([]CardMember, error)
+
+	// Scan pages through the cards of all users, continuing after cursor.
+	// The returned cursor is empty when there are no more cards.
+	Scan(ctx context.Context, limit int, cursor string) ([]Card, string, error)
+}
+
+// CardInviteService represents a service for managing card invites.
+type CardInviteService interface {
+	// Create creates an invite, replacing the permission of an existing one
+	// to the same card for the email.
+	Create(ctx context.Context, invite *CardInvite) error
+
+	// Delete deletes the invite to a card for an email.
+	Delete(ctx context.Context, cardID, email string) error
+
+	// List lists the invites to a card.
+	List(ctx context.Context, cardID string) ([]CardInvite, error)
+
+	// ListByEmail lists the invites for an email.
+	ListByEmail(ctx context.Context, email string) ([]CardInvite, error)
+}
+
+// CursorService represents a service for keeping the cursors of scans by
+// name, so a scan cut short resumes where it stopped.
+type CursorService interface {
+	// Get returns the cursor saved under name, empty when there is none.
+	Get(ctx context.Context, name string) (string, error)
+
+	// Put saves a cursor under name, deleting it when empty.
+	Put(ctx context.Context, name, cursor string) error
+}
+
+// BalanceSnapshot is the balance of a card at a point in time.
+type BalanceSnapshot struct {
+	Balance float64   `json:"balance"`
+	CardID  string    `json:"-"`
+	Time    time.Time `json:"time"`
+}
+
+// BalanceHistoryService represents a service for managing the balance history
+// of cards.
+type BalanceHistoryService interface {
+	Append(ctx context.Context, snapshot *BalanceSnapshot) error
+
+	// List returns up to limit snapshots of a card taken between from and to
+	// inclusive, oldest first. A zero from or to leaves that end unbounded.
+	// The returned cursor is passed back to continue after the last snapshot,
+	// and is empty when there are no more.
+	List(ctx context.Context, cardID string, from, to time.Time, limit int, cursor string) ([]BalanceSnapshot, string, error)
+
+	// Delete deletes the snapshots of a card.
+	Delete(ctx context.Context, cardID string) error
+}
+
+// CardEventType is the type of a CardEvent.
+type CardEventType string
+
+// Card event types.
+const (
+	// CardEventRecharge is an increase of the balance.
+	CardEventRecharge CardEventType = "recharge"
+
+	// CardEventTrip is a decrease of the balance by a multiple of the fare.
+	CardEventTrip CardEventType = "trip"
+
+	// CardEventAdjustment is any other decrease of the balance.
+	CardEventAdjustment CardEventType = "adjustment"
+)
+
+// CardEvent is a change of a card's balance between two readings.
+type CardEvent struct {
+	Amount  float64       `json:"amount"`
+	Balance float64       `json:"balance"`
+	CardID  string        `json:"-"`
+	Time    time.Time     `json:"time"`
+	Trips   int           `json:"trips,omitempty"`
+	Type    CardEventType `json:"type"`
+}
+
+// CardEventService represents a service for managing card events.
+type CardEventService interface {
+	Create(ctx context.Context, event *CardEvent) error
+
+	// List returns events of a card with the same range and pagination
+	// semantics as BalanceHistoryService.List.
+	List(ctx context.Context, cardID string, from, to time.Time, limit int, cursor string) ([]CardEvent, string, error)
+
+	// Delete deletes the events of a card.
+	Delete(ctx context.Context, cardID string) error
 }
 
 // LoginRequest is a login request for a user.
 type LoginRequest struct {
+	// Email is where the verification is sent.
+	Email string `json:"-" dynamodbav:"email"`
+
 	RequestToken      string `json:"request_token"`
 	UserID            string `json:"-" dynamodbav:"u_id"`
 	VerificationToken string `json:"verification_token"`
@@ -27,23 +260,207 @@ type LoginRequest struct {
 }
 
 // LoginRequestService represents a service for managing login requests.
+//
+// Verify only succeeds once for an unverified request with a matching
+// verification token, and Delete only succeeds for a verified request with a
+// matching request token. Both return ErrInvalidLoginRequest otherwise.
 type LoginRequestService interface {
-	Create(request *LoginRequest) error
-	Delete(email, code string) error
+	Create(ctx context.Context, request *LoginRequest) error
+	Delete(ctx context.Context, userID, code string) error
+
+	Verify(ctx context.Context, userID, token string) error
+}
+
+// RefreshToken is a family of refresh tokens, started by a login and rotated
+// on every use. Only the hash of the current token is stored, since tokens
+// carry their family any other one is a reused or forged token.
+type RefreshToken struct {
+	CreatedAt time.Time `json:"created_at" dynamodbav:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" dynamodbav:"expires_at,unixtime"`
+	FamilyID  string    `json:"id" dynamodbav:"id"`
+	Hash      string    `json:"-" dynamodbav:"hash"`
+	Revoked   bool      `json:"-" dynamodbav:"revoked"`
+	UserID    string    `json:"-" dynamodbav:"u_id"`
+}
+
+// RefreshTokenService represents a service for managing refresh tokens.
+type RefreshTokenService interface {
+	Create(ctx context.Context, token *RefreshToken) error
+
+	// Rotate replaces the current hash of a family by next, extending it
+	// until expiresAt. It returns ErrInvalidRefreshToken unless the family is
+	// valid, and ErrRefreshTokenReused, revoking the family, when hash is not
+	// the current one.
+	Rotate(ctx context.Context, familyID, hash, next string, expiresAt time.Time) (*RefreshToken, error)
+
+	// Revoke revokes a family.
+	Revoke(ctx context.Context, familyID string) error
+
+	// RevokeUser revokes every family of a user.
+	RevokeUser(ctx context.Context, userID string) error
+}
+
+// Revocation are the revoked access tokens of a user. It only needs to be
+// kept until the last token it revokes expires.
+type Revocation struct {
+	ExpiresAt time.Time `dynamodbav:"expires_at,unixtime"`
+	UserID    string    `dynamodbav:"u_id"`
+
+	// NotBefore revokes the tokens issued before it. It is in whole seconds
+	// like their iat, so tokens issued in its second are kept since they
+	// can't be told apart from the ones issued right after.
+	NotBefore time.Time `dynamodbav:"not_before,unixtime,omitempty"`
+
+	// Sessions are the ids of the revoked sessions.
+	Sessions []string `dynamodbav:"sessions,stringset,omitempty"`
+}
+
+// Revoked reports whether the token of a session issued at the given time
+// was revoked.
+func (r *Revocation) Revoked(sessionID string, issuedAt time.Time) bool {
+	if !r.NotBefore.IsZero() && issuedAt.Truncate(time.Second).Before(r.NotBefore) {
+		return true
+	}
+
+	for _, s := range r.Sessions {
+		if s == sessionID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RevocationService represents a service for revoking access tokens.
+//
+// Revocations are kept until expiresAt, which callers set to when the last
+// token issued so far expires.
+type RevocationService interface {
+	// Find returns the revocation of a user, or nil when none is in effect.
+	Find(ctx context.Context, userID string) (*Revocation, error)
+
+	// RevokeSession revokes the tokens of a session.
+	RevokeSession(ctx context.Context, userID, sessionID string, expiresAt time.Time) error
 
-	Verify(email, token string) error
+	// RevokeAll revokes the tokens of a user issued before the second of
+	// before.
+	RevokeAll(ctx context.Context, userID string, before, expiresAt time.Time) error
 }
 
 // User is an individual's account on Saldo TUC.
 type User struct {
-	FacebookID string `json:"-" dynamodbav:"facebook_id,omitempty"`
-	GoogleID   string `json:"-" dynamodbav:"google_id,omitempty"`
-	ID         string `json:"id"`
+	// ID is generated when the user is created and never changes, unlike
+	// the email.
+	ID            string                   `json:"id"`
+	Email         string                   `json:"email" dynamodbav:"email,omitempty"`
+	Notifications *NotificationPreferences `json:"-" dynamodbav:"notifications,omitempty"`
+
+	// Identities are the subjects of the user in each identity provider,
+	// keyed by provider name.
+	Identities map[string]string `json:"-" dynamodbav:"identities,omitempty"`
+}
+
+// Preferences returns the notification preferences of the user, or the
+// defaults when none were set.
+func (u *User) Preferences() NotificationPreferences {
+	if u.Notifications == nil {
+		return DefaultNotificationPreferences
+	}
+
+	return *u.Notifications
+}
+
+// NotificationPreferences are the notification defaults of a user.
+type NotificationPreferences struct {
+	Email    bool   `json:"email" dynamodbav:"email"`
+	Language string `json:"language" dynamodbav:"language"`
+	Push     bool   `json:"push" dynamodbav:"push"`
+
+	// QuietHoursStart and QuietHoursEnd are HH:MM times of day between which
+	// push notifications are held, disabled when empty.
+	QuietHoursEnd   string `json:"quiet_hours_end,omitempty" dynamodbav:"quiet_hours_end,omitempty"`
+	QuietHoursStart string `json:"quiet_hours_start,omitempty" dynamodbav:"quiet_hours_start,omitempty"`
+}
+
+// DefaultNotificationPreferences are the preferences of users who did not set
+// any.
+var DefaultNotificationPreferences = NotificationPreferences{
+	Email:    true,
+	Language: "es",
+	Push:     true,
 }
 
 // UserService represents a service for managing users.
 type UserService interface {
-	Find(email string) (*User, error)
-	Create(user *User) error
-	Update(user *User) error
+	Find(ctx context.Context, id string) (*User, error)
+
+	// FindByEmail returns the user with an email, or nil.
+	FindByEmail(ctx context.Context, email string) (*User, error)
+
+	// FindByIdentity returns the user linked to the subject of an identity
+	// provider, or nil.
+	FindByIdentity(ctx context.Context, provider, subject string) (*User, error)
+
+	// Create creates a user, returning ErrEmailTaken or ErrIdentityTaken when
+	// another user has its email or one of its identities.
+	Create(ctx context.Context, user *User) error
+
+	// ChangeEmail changes the email of a user, returning ErrEmailTaken when
+	// another user has it.
+	ChangeEmail(ctx context.Context, id, email string) error
+
+	// Link links the subject of an identity provider to a user, replacing
+	// the one linked before. It returns ErrIdentityTaken when the subject is
+	// linked to another user.
+	Link(ctx context.Context, id, provider, subject string) error
+	UpdateNotifications(ctx context.Context, id string, prefs *NotificationPreferences) error
+}
+
+// EmailChange is a change of the email of a user. It completes once the new
+// email is confirmed, and the old email can cancel it, reverting it if
+// completed, until it expires.
+type EmailChange struct {
+	CancelToken  string    `dynamodbav:"cancel_token"`
+	ConfirmToken string    `dynamodbav:"confirm_token"`
+	Confirmed    bool      `dynamodbav:"confirmed"`
+	ExpiresAt    time.Time `dynamodbav:"expires_at,unixtime"`
+	NewEmail     string    `dynamodbav:"new_email"`
+	OldEmail     string    `dynamodbav:"old_email"`
+	UserID       string    `dynamodbav:"u_id"`
+}
+
+// EmailChangeService represents a service for managing email changes. A user
+// has one change at most.
+type EmailChangeService interface {
+	// Create creates the change of a user, replacing an unconfirmed or
+	// expired one. It returns ErrEmailChangePending while a confirmed change
+	// can be cancelled.
+	Create(ctx context.Context, change *EmailChange) error
+
+	// Confirm confirms the change of a user, keeping it until expiresAt. It
+	// returns ErrInvalidEmailChange unless token is the confirm token of an
+	// unconfirmed, unexpired change.
+	Confirm(ctx context.Context, userID, token string, expiresAt time.Time) (*EmailChange, error)
+
+	// Cancel deletes the change of a user, returning ErrInvalidEmailChange
+	// unless token is the cancel token of an unexpired change.
+	Cancel(ctx context.Context, userID, token string) (*EmailChange, error)
+}
+
+// Identity is who a token of an identity provider belongs to.
+type Identity struct {
+	Email string
+
+	// Subject is the stable id of the user in the provider.
+	Subject string
+}
+
+// IdentityProvider verifies the tokens of a social login provider.
+type IdentityProvider interface {
+	// Name is the name identities of the provider are linked by.
+	Name() string
+
+	// Verify verifies a token, returning ErrInvalidIdentityToken when it was
+	// not issued to the app or has no email.
+	Verify(ctx context.Context, token string) (*Identity, error)
 }